@@ -0,0 +1,170 @@
+// Sound output. The vm reports when its sound timer starts and
+// stops, and squareSink turns that into a square wave streamed to
+// oto, or into the XO-CHIP pattern once a program loads one.
+
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"sync"
+
+	oto "github.com/ebitengine/oto/v3"
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	sampleRate = 44100
+
+	muteKey = ebiten.KeyM
+)
+
+// Plays the sound of the vm through oto. It is an endless stream
+// of 16 bit stereo samples that is silent while the sound timer
+// is not running.
+type squareSink struct {
+	mu sync.Mutex
+
+	// Set by the vm.
+	on      bool
+	pattern [16]uint8
+	pitch   uint8
+
+	// Set by the frontend while the vm is paused or rewinding,
+	// when the sound timer is not being ticked.
+	suspended bool
+
+	freq   float64
+	volume float64
+	muted  bool
+
+	// Position within the current square wave period, or within
+	// the 128 bit XO-CHIP pattern.
+	phase float64
+}
+
+// Keeps a reference so the player is not collected.
+var audioPlayer *oto.Player
+
+// Returns a sink playing a tone of freq Hz at volume, from 0 to 1.
+func newSquareSink(freq, volume float64, muted bool) *squareSink {
+	return &squareSink{
+		freq:   freq,
+		volume: math.Max(0, math.Min(volume, 1)),
+		muted:  muted,
+		pitch:  64,
+	}
+}
+
+// Starts streaming the sink to the speakers.
+func (s *squareSink) start() {
+	ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   sampleRate,
+		ChannelCount: 2,
+		Format:       oto.FormatSignedInt16LE,
+	})
+	if err != nil {
+		log.Printf("Error creating new audio context: %s\n", err)
+		return
+	}
+
+	go func() {
+		<-ready
+
+		audioPlayer = ctx.NewPlayer(s)
+		// Keep the buffer short so the sound starts and stops
+		// within a couple of frames of the timer.
+		audioPlayer.SetBufferSize(sampleRate / 30 * 4)
+		audioPlayer.Play()
+	}()
+}
+
+func (s *squareSink) Sound(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.on = on
+}
+
+func (s *squareSink) Pattern(pattern [16]uint8, pitch uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pattern, s.pitch = pattern, pitch
+}
+
+func (s *squareSink) suspend(suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suspended = suspended
+}
+
+// Mutes or unmutes the sound and reports whether it is now muted.
+func (s *squareSink) toggleMute() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.muted = !s.muted
+	return s.muted
+}
+
+func (s *squareSink) Read(buf []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playing := s.on && !s.suspended && !s.muted
+	amplitude := s.volume * math.MaxInt16
+
+	// XO-CHIP patterns are played one bit per sample at a rate
+	// set by the pitch register, anything else as a plain tone.
+	usePattern := s.pattern != [16]uint8{}
+	var step float64
+	if usePattern {
+		step = 4000 * math.Pow(2, (float64(s.pitch)-64)/48) / sampleRate
+	} else {
+		step = s.freq / sampleRate
+	}
+
+	n := len(buf) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		var sample int16
+		if playing {
+			var high bool
+			if usePattern {
+				bit := int(s.phase)
+				high = s.pattern[bit/8]>>(7-bit%8)&1 == 1
+				s.phase = math.Mod(s.phase+step, 128)
+			} else {
+				high = s.phase < 0.5
+				s.phase = math.Mod(s.phase+step, 1)
+			}
+
+			if high {
+				sample = int16(amplitude)
+			} else {
+				sample = int16(-amplitude)
+			}
+		}
+
+		binary.LittleEndian.PutUint16(buf[i:], uint16(sample))
+		binary.LittleEndian.PutUint16(buf[i+2:], uint16(sample))
+	}
+
+	return n, nil
+}
+
+// Toggles the sound with the mute key.
+func (g *Game) handleMuteKey() {
+	if !inpututil.IsKeyJustPressed(muteKey) {
+		return
+	}
+
+	if g.audio.toggleMute() {
+		g.notify("Sound muted.")
+	} else {
+		g.notify("Sound on.")
+	}
+}
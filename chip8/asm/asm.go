@@ -0,0 +1,304 @@
+// Package asm assembles Octo source (.8o) into CHIP-8, SUPER-CHIP
+// and XO-CHIP machine code.
+//
+// It supports labels, :const, :alias, :macro, :call, :org, :byte,
+// loop/while/again, if ... then and if ... begin/else/end, and the
+// register statements such as `v0 += 3`. Octo's :calc, :stringmode
+// and comparison operators like < are not supported.
+//
+// As in Octo, programs start at the `: main` label. 0x200 holds a
+// jump to it, which is left out when main is the first thing
+// there.
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Where programs are loaded.
+const origin = 0x200
+
+// An assembled program.
+type Program struct {
+	// The machine code, to be loaded at 0x200.
+	ROM []byte
+
+	// Every label and the address it points at.
+	Symbols map[string]uint16
+}
+
+// A mistake in the source.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Msg)
+}
+
+// How a forward reference to a label gets patched in.
+type fixupKind uint8
+
+const (
+	// The low 12 bits of the opcode at addr.
+	fix12 fixupKind = iota
+
+	// The whole 16 bit word at addr, for i := long.
+	fix16
+)
+
+type fixup struct {
+	addr int
+	name string
+	line int
+	kind fixupKind
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+// An open loop or if ... begin block.
+type frame struct {
+	loop bool
+
+	// loop: where again jumps back to.
+	start int
+
+	// Jumps to patch with the address after the block. For a
+	// begin this is the jump over the block, for a loop the
+	// jumps out of it made by while.
+	exits []int
+
+	hasElse bool
+}
+
+type assembler struct {
+	toks []token
+	pos  int
+
+	mem  [0x10000]byte
+	here int
+	top  int
+
+	labels  map[string]int
+	consts  map[string]int
+	aliases map[string]int
+	macros  map[string]*macro
+
+	fixups []fixup
+	frames []*frame
+
+	// Set once the jump to main is in place, or known not to be
+	// needed.
+	entered bool
+}
+
+// Assembles Octo source into a program.
+func Assemble(src string) (p *Program, err error) {
+	a := &assembler{
+		toks:    tokenize(src),
+		here:    origin,
+		top:     origin,
+		labels:  map[string]int{},
+		consts:  map[string]int{},
+		aliases: map[string]int{},
+		macros:  map[string]*macro{},
+	}
+
+	// Errors are raised with panic deep in the parser and turned
+	// back into an error here.
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			p, err = nil, e
+		}
+	}()
+
+	for a.pos < len(a.toks) {
+		a.statement()
+	}
+
+	if len(a.frames) > 0 {
+		a.fail(a.lastLine(), "Missing 'end' or 'again'.")
+	}
+
+	if _, ok := a.labels["main"]; !ok {
+		a.fail(a.lastLine(), "Missing ': main' to start the program at.")
+	}
+
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.name]
+		if !ok {
+			a.fail(f.line, fmt.Sprintf("Undefined label %q.", f.name))
+		}
+
+		switch f.kind {
+		case fix12:
+			if addr > 0xfff {
+				a.fail(f.line, fmt.Sprintf("Label %q is past 0xFFF, use i := long.", f.name))
+			}
+			a.mem[f.addr] |= byte(addr >> 8)
+			a.mem[f.addr+1] = byte(addr)
+		case fix16:
+			a.mem[f.addr] = byte(addr >> 8)
+			a.mem[f.addr+1] = byte(addr)
+		}
+	}
+
+	p = &Program{
+		ROM:     append([]byte(nil), a.mem[origin:a.top]...),
+		Symbols: map[string]uint16{},
+	}
+	for name, addr := range a.labels {
+		p.Symbols[name] = uint16(addr)
+	}
+
+	return p, nil
+}
+
+// Writes the symbol map, one "address name" pair per line in
+// address order.
+func (p *Program) WriteSymbols(w io.Writer) error {
+	names := make([]string, 0, len(p.Symbols))
+	for n := range p.Symbols {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := p.Symbols[names[i]], p.Symbols[names[j]]
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	var buf bytes.Buffer
+	for _, n := range names {
+		fmt.Fprintf(&buf, "0x%04x %s\n", p.Symbols[n], n)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Returns the ROM for a file given its name and contents. Octo
+// sources ending in .8o are assembled, anything else is taken to
+// be a ROM already.
+func Load(name string, b []byte) ([]byte, error) {
+	if !strings.EqualFold(filepath.Ext(name), ".8o") {
+		return b, nil
+	}
+
+	p, err := Assemble(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return p.ROM, nil
+}
+
+// Reads a ROM from disk, assembling it first if it is an Octo
+// source file.
+func ReadFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(path, b)
+}
+
+func (a *assembler) fail(line int, msg string) {
+	panic(&Error{Line: line, Msg: msg})
+}
+
+func (a *assembler) lastLine() int {
+	if len(a.toks) == 0 {
+		return 1
+	}
+
+	return a.toks[len(a.toks)-1].line
+}
+
+func (a *assembler) next() token {
+	if a.pos >= len(a.toks) {
+		a.fail(a.lastLine(), "Unexpected end of file.")
+	}
+
+	t := a.toks[a.pos]
+	a.pos++
+
+	return t
+}
+
+func (a *assembler) peek() string {
+	if a.pos >= len(a.toks) {
+		return ""
+	}
+
+	return a.toks[a.pos].text
+}
+
+func (a *assembler) expect(text string) {
+	if t := a.next(); t.text != text {
+		a.fail(t.line, fmt.Sprintf("Expected %q but got %q.", text, t.text))
+	}
+}
+
+// Puts the jump to main at 0x200 ahead of the first byte, unless
+// main is already there. Labels and loops that were started at
+// 0x200 move past the jump along with the code that follows them.
+func (a *assembler) enter(line int) {
+	if a.entered {
+		return
+	}
+	a.entered = true
+
+	if addr, ok := a.labels["main"]; ok && addr == origin {
+		return
+	}
+
+	for name, addr := range a.labels {
+		if addr == origin {
+			a.labels[name] = origin + 2
+		}
+	}
+	for _, f := range a.frames {
+		if f.start == origin {
+			f.start = origin + 2
+		}
+	}
+
+	a.mem[origin] = 0x10
+	a.fixups = append(a.fixups, fixup{addr: origin, name: "main", line: line, kind: fix12})
+	a.here = origin + 2
+	a.top = max(a.top, a.here)
+}
+
+func (a *assembler) emitByte(line int, b byte) {
+	a.enter(line)
+
+	if a.here > 0xffff {
+		a.fail(line, "Program does not fit in memory.")
+	}
+
+	a.mem[a.here] = b
+	a.here++
+	a.top = max(a.top, a.here)
+}
+
+func (a *assembler) emit(line int, op uint16) {
+	a.emitByte(line, byte(op>>8))
+	a.emitByte(line, byte(op))
+}
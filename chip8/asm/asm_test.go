@@ -0,0 +1,258 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oliveira-a/gochip/chip8"
+	"github.com/oliveira-a/gochip/chip8/disasm"
+)
+
+func assemble(t *testing.T, src string) []byte {
+	t.Helper()
+
+	p, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p.ROM
+}
+
+func TestAssemblesStatements(t *testing.T) {
+	for _, tc := range []struct {
+		src string
+		out []byte
+	}{
+		{"clear return", []byte{0x00, 0xe0, 0x00, 0xee}},
+		{"scroll-down 4 hires", []byte{0x00, 0xc4, 0x00, 0xff}},
+		{"va := 0x10", []byte{0x6a, 0x10}},
+		{"v1 += 3 v1 -= 1", []byte{0x71, 0x03, 0x71, 0xff}},
+		{"v1 =- v2 v3 <<= v4", []byte{0x81, 0x27, 0x83, 0x4e}},
+		{"v0 := random 0b1111", []byte{0xc0, 0x0f}},
+		{"v5 := key v6 := delay", []byte{0xf5, 0x0a, 0xf6, 0x07}},
+		{"sprite v1 v2 5", []byte{0xd1, 0x25}},
+		{"save v2 - v4 load v7", []byte{0x52, 0x42, 0xf7, 0x65}},
+		{"i := 0x300 i += v2", []byte{0xa3, 0x00, 0xf2, 0x1e}},
+		{"i := long 0x1234", []byte{0xf0, 0x00, 0x12, 0x34}},
+		{"i := bighex v5 plane 3", []byte{0xf5, 0x30, 0xf3, 0x01}},
+		{"if va != 0x10 then clear", []byte{0x3a, 0x10, 0x00, 0xe0}},
+		{"if v1 == v2 then clear", []byte{0x91, 0x20, 0x00, 0xe0}},
+		{"if v3 key then clear", []byte{0xe3, 0xa1, 0x00, 0xe0}},
+		{"1 0xff -1", []byte{0x01, 0xff, 0xff}},
+	} {
+		if got := assemble(t, ": main "+tc.src); !bytes.Equal(got, tc.out) {
+			t.Errorf("%q: got % x, want % x", tc.src, got, tc.out)
+		}
+	}
+}
+
+func TestResolvesLabels(t *testing.T) {
+	p, err := Assemble(`
+		: main
+			i := sprite
+			draw
+			jump main
+		: draw
+			return
+		: sprite
+			0x80
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0xa2, 0x08, 0x22, 0x06, 0x12, 0x00, 0x00, 0xee, 0x80}
+	if !bytes.Equal(p.ROM, want) {
+		t.Fatalf("got % x", p.ROM)
+	}
+
+	if p.Symbols["main"] != 0x200 || p.Symbols["draw"] != 0x206 || p.Symbols["sprite"] != 0x208 {
+		t.Fatalf("got %v", p.Symbols)
+	}
+}
+
+func TestAssemblesControlFlow(t *testing.T) {
+	got := assemble(t, `
+		: main
+		loop
+			while v0 != 5
+			if v1 == 0 begin
+				v0 += 1
+			else
+				v0 += 2
+			end
+		again
+	`)
+
+	want := []byte{
+		0x40, 0x05, // 200: skip if v0 != 5
+		0x12, 0x10, // 202: jump 210
+		0x31, 0x00, // 204: skip if v1 == 0
+		0x12, 0x0c, // 206: jump 20c
+		0x70, 0x01, // 208
+		0x12, 0x0e, // 20a: jump 20e
+		0x70, 0x02, // 20c
+		0x12, 0x00, // 20e: again
+	}
+	if !bytes.Equal(got[:len(want)], want) || len(got) != len(want) {
+		t.Fatalf("got % x", got)
+	}
+}
+
+func TestAcceptsWhileInsideIfWithinLoop(t *testing.T) {
+	got := assemble(t, `
+		: main
+		loop
+			if v1 == 0 begin
+				while v0 != 5
+				v0 += 1
+			end
+		again
+	`)
+
+	want := []byte{
+		0x31, 0x00, // 200: skip if v1 == 0
+		0x12, 0x0a, // 202: jump 20a
+		0x40, 0x05, // 204: skip if v0 != 5
+		0x12, 0x0c, // 206: jump 20c
+		0x70, 0x01, // 208
+		0x12, 0x00, // 20a: again
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got % x", got)
+	}
+
+	if _, err := Assemble(": main if v1 == 0 begin while v0 != 5 end"); err == nil {
+		t.Fatal("accepted while outside a loop")
+	}
+}
+
+func TestExpandsMacrosConstantsAndAliases(t *testing.T) {
+	got := assemble(t, `
+		:const speed 3
+		:alias x v4
+		:macro move reg amount { reg += amount }
+		: main
+		move x speed
+		move v5 1
+	`)
+
+	if !bytes.Equal(got, []byte{0x74, 0x03, 0x75, 0x01}) {
+		t.Fatalf("got % x", got)
+	}
+}
+
+func TestReportsErrorLine(t *testing.T) {
+	_, err := Assemble("clear\n\nvg := 1 # typo\n")
+
+	var e *Error
+	if !errors.As(err, &e) || e.Line != 3 {
+		t.Fatalf("got %v", err)
+	}
+
+	if _, err := Assemble(": main jump nowhere"); err == nil {
+		t.Fail()
+	}
+
+	if _, err := Assemble(": main loop clear"); err == nil {
+		t.Fail()
+	}
+
+	if _, err := Assemble("clear"); err == nil {
+		t.Fatal("assembled a program without main")
+	}
+}
+
+func TestLoadAssemblesOctoSources(t *testing.T) {
+	rom, err := Load("game.8o", []byte(": main clear"))
+	if err != nil || !bytes.Equal(rom, []byte{0x00, 0xe0}) {
+		t.Fatalf("got % x %v", rom, err)
+	}
+
+	rom, _ = Load("game.ch8", []byte("clear"))
+	if string(rom) != "clear" {
+		t.Fail()
+	}
+}
+
+// Every bundled ROM should survive being disassembled and assembled
+// again unchanged.
+func TestRoundTripsDisassembly(t *testing.T) {
+	paths, _ := filepath.Glob("../../static/roms/*.ch8")
+	if len(paths) == 0 {
+		t.Skip("no roms")
+	}
+
+	for _, path := range paths {
+		rom, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var src bytes.Buffer
+		if err := disasm.Disassemble(rom, 0x200).WriteOcto(&src); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := Assemble(src.String())
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if !bytes.Equal(p.ROM, rom) {
+			t.Errorf("%s: round trip differs", path)
+		}
+	}
+}
+
+// Programs start at main whether or not it comes first, and
+// survive a round trip through the disassembler either way.
+func TestStartsAtMain(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want []byte
+	}{
+		{
+			"main first",
+			": main helper loop again : helper v0 := 1 return",
+			[]byte{0x22, 0x04, 0x12, 0x02, 0x60, 0x01, 0x00, 0xee},
+		},
+		{
+			"main after a subroutine",
+			": helper v0 := 1 return : main helper loop again",
+			[]byte{0x12, 0x06, 0x60, 0x01, 0x00, 0xee, 0x22, 0x02, 0x12, 0x08},
+		},
+	} {
+		rom := assemble(t, tc.src)
+		if !bytes.Equal(rom, tc.want) {
+			t.Errorf("%s: got % x, want % x", tc.name, rom, tc.want)
+			continue
+		}
+
+		vm := chip8.New(chip8.WithQuirks(chip8.QuirksVIP))
+		if err := vm.LoadRom(rom); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if err := vm.Cycle(); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+		if vm.Registers().V[0] != 1 {
+			t.Errorf("%s: helper did not run", tc.name)
+		}
+
+		var src bytes.Buffer
+		if err := disasm.Disassemble(rom, 0x200).WriteOcto(&src); err != nil {
+			t.Fatal(err)
+		}
+		if again := assemble(t, src.String()); !bytes.Equal(again, rom) {
+			t.Errorf("%s: round trip gave % x", tc.name, again)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package asm
+
+import "strings"
+
+type token struct {
+	text string
+	line int
+}
+
+// Splits Octo source into whitespace separated tokens, dropping
+// comments which run from # to the end of the line.
+func tokenize(src string) []token {
+	var toks []token
+
+	for i, line := range strings.Split(src, "\n") {
+		if c := strings.IndexByte(line, '#'); c >= 0 {
+			line = line[:c]
+		}
+
+		for _, f := range strings.Fields(line) {
+			toks = append(toks, token{text: f, line: i + 1})
+		}
+	}
+
+	return toks
+}
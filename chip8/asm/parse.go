@@ -0,0 +1,547 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The opcodes for a condition: skipFalse skips the next instruction
+// when the condition does not hold (used by then) and skipTrue when
+// it does (used by begin and while).
+type condition struct {
+	skipFalse uint16
+	skipTrue  uint16
+}
+
+// Assembles a single statement.
+func (a *assembler) statement() {
+	t := a.next()
+
+	switch t.text {
+	case ":":
+		a.defineLabel(a.next())
+	case ":const":
+		name := a.next()
+		a.checkName(name)
+		a.consts[name.text] = a.value(a.next())
+	case ":alias":
+		name := a.next()
+		a.checkName(name)
+		a.aliases[name.text] = int(a.register(a.next()))
+	case ":macro":
+		a.defineMacro()
+	case ":call":
+		a.emitAddress(a.next(), 0x2000)
+	case ":org":
+		addr := a.value(a.next())
+		if addr < origin || addr > 0xffff {
+			a.fail(t.line, fmt.Sprintf("Cannot :org to 0x%x.", addr))
+		}
+		a.enter(t.line)
+		a.here = addr
+	case ":byte":
+		a.emitByte(t.line, a.byteValue(a.next()))
+	case "clear":
+		a.emit(t.line, 0x00e0)
+	case "return", ";":
+		a.emit(t.line, 0x00ee)
+	case "scroll-down":
+		a.emit(t.line, 0x00c0|a.nibble(a.next()))
+	case "scroll-up":
+		a.emit(t.line, 0x00d0|a.nibble(a.next()))
+	case "scroll-right":
+		a.emit(t.line, 0x00fb)
+	case "scroll-left":
+		a.emit(t.line, 0x00fc)
+	case "exit":
+		a.emit(t.line, 0x00fd)
+	case "lores":
+		a.emit(t.line, 0x00fe)
+	case "hires":
+		a.emit(t.line, 0x00ff)
+	case "jump":
+		a.emitAddress(a.next(), 0x1000)
+	case "jump0":
+		a.emitAddress(a.next(), 0xb000)
+	case "sprite":
+		x := a.register(a.next())
+		y := a.register(a.next())
+		n := a.nibble(a.next())
+		a.emit(t.line, 0xd000|x<<8|y<<4|n)
+	case "plane":
+		a.emit(t.line, 0xf001|a.nibble(a.next())<<8)
+	case "audio":
+		a.emit(t.line, 0xf002)
+	case "delay":
+		a.expect(":=")
+		a.emit(t.line, 0xf015|a.register(a.next())<<8)
+	case "buzzer":
+		a.expect(":=")
+		a.emit(t.line, 0xf018|a.register(a.next())<<8)
+	case "pitch":
+		a.expect(":=")
+		a.emit(t.line, 0xf03a|a.register(a.next())<<8)
+	case "bcd":
+		a.emit(t.line, 0xf033|a.register(a.next())<<8)
+	case "save", "load":
+		a.saveLoad(t)
+	case "saveflags":
+		a.emit(t.line, 0xf075|a.register(a.next())<<8)
+	case "loadflags":
+		a.emit(t.line, 0xf085|a.register(a.next())<<8)
+	case "i":
+		a.indexStatement()
+	case "if":
+		a.ifStatement()
+	case "else":
+		a.elseStatement(t)
+	case "end":
+		f := a.popFrame(t, false)
+		a.patchExits(f)
+	case "loop":
+		a.frames = append(a.frames, &frame{loop: true, start: a.here})
+	case "while":
+		f := a.loopFrame(t)
+		a.emit(t.line, a.condition().skipTrue)
+		f.exits = append(f.exits, a.here)
+		a.emit(t.line, 0x1000)
+	case "again":
+		f := a.popFrame(t, true)
+		a.emit(t.line, 0x1000|uint16(f.start))
+		a.patchExits(f)
+	default:
+		a.bareStatement(t)
+	}
+}
+
+// Handles statements that do not start with a keyword: register
+// statements, macro invocations, data bytes and calls.
+func (a *assembler) bareStatement(t token) {
+	if _, ok := a.registerIndex(t.text); ok {
+		a.registerStatement(t)
+		return
+	}
+
+	if m, ok := a.macros[t.text]; ok {
+		a.expandMacro(m)
+		return
+	}
+
+	if _, ok := parseNumber(t.text); ok {
+		a.emitByte(t.line, a.byteValue(t))
+		return
+	}
+
+	if strings.HasPrefix(t.text, ":") || !validName(t.text) {
+		a.fail(t.line, fmt.Sprintf("Unknown statement %q.", t.text))
+	}
+
+	// Anything else is a call to a label which may not be defined
+	// yet.
+	a.emitAddress(t, 0x2000)
+}
+
+func (a *assembler) registerStatement(t token) {
+	x := a.register(t)
+	op := a.next()
+	rhs := a.next()
+
+	if y, ok := a.registerIndex(rhs.text); ok {
+		ops := map[string]uint16{
+			":=":  0x0,
+			"|=":  0x1,
+			"&=":  0x2,
+			"^=":  0x3,
+			"+=":  0x4,
+			"-=":  0x5,
+			">>=": 0x6,
+			"=-":  0x7,
+			"<<=": 0xe,
+		}
+		n, ok := ops[op.text]
+		if !ok {
+			a.fail(op.line, fmt.Sprintf("Unknown operator %q.", op.text))
+		}
+		a.emit(t.line, 0x8000|x<<8|uint16(y)<<4|n)
+		return
+	}
+
+	switch {
+	case op.text == ":=" && rhs.text == "random":
+		a.emit(t.line, 0xc000|x<<8|uint16(a.byteValue(a.next())))
+	case op.text == ":=" && rhs.text == "key":
+		a.emit(t.line, 0xf00a|x<<8)
+	case op.text == ":=" && rhs.text == "delay":
+		a.emit(t.line, 0xf007|x<<8)
+	case op.text == ":=":
+		a.emit(t.line, 0x6000|x<<8|uint16(a.byteValue(rhs)))
+	case op.text == "+=":
+		a.emit(t.line, 0x7000|x<<8|uint16(a.byteValue(rhs)))
+	case op.text == "-=":
+		a.emit(t.line, 0x7000|x<<8|uint16(-a.byteValue(rhs)))
+	default:
+		a.fail(op.line, fmt.Sprintf("Operator %q needs a register.", op.text))
+	}
+}
+
+func (a *assembler) indexStatement() {
+	op := a.next()
+
+	switch op.text {
+	case ":=":
+	case "+=":
+		a.emit(op.line, 0xf01e|a.register(a.next())<<8)
+		return
+	default:
+		a.fail(op.line, fmt.Sprintf("Unknown operator %q.", op.text))
+	}
+
+	rhs := a.next()
+	switch rhs.text {
+	case "hex":
+		a.emit(op.line, 0xf029|a.register(a.next())<<8)
+	case "bighex":
+		a.emit(op.line, 0xf030|a.register(a.next())<<8)
+	case "long":
+		a.emit(op.line, 0xf000)
+		v := a.next()
+		if n, ok := a.constant(v.text); ok {
+			a.emit(v.line, uint16(n))
+			return
+		}
+		a.checkLabelRef(v)
+		a.fixups = append(a.fixups, fixup{addr: a.here, name: v.text, line: v.line, kind: fix16})
+		a.emit(v.line, 0)
+	default:
+		a.emitAddress(rhs, 0xa000)
+	}
+}
+
+func (a *assembler) saveLoad(t token) {
+	base := uint16(0xf055)
+	if t.text == "load" {
+		base = 0xf065
+	}
+
+	x := a.register(a.next())
+	if a.peek() != "-" {
+		a.emit(t.line, base|x<<8)
+		return
+	}
+
+	a.next()
+	y := a.register(a.next())
+	if t.text == "save" {
+		a.emit(t.line, 0x5002|x<<8|y<<4)
+	} else {
+		a.emit(t.line, 0x5003|x<<8|y<<4)
+	}
+}
+
+func (a *assembler) ifStatement() {
+	c := a.condition()
+	t := a.next()
+
+	switch t.text {
+	case "then":
+		a.emit(t.line, c.skipFalse)
+		a.statement()
+	case "begin":
+		a.emit(t.line, c.skipTrue)
+		a.frames = append(a.frames, &frame{exits: []int{a.here}})
+		a.emit(t.line, 0x1000)
+	default:
+		a.fail(t.line, fmt.Sprintf("Expected 'then' or 'begin' but got %q.", t.text))
+	}
+}
+
+func (a *assembler) elseStatement(t token) {
+	f := a.topFrame(t, false)
+	if f.hasElse {
+		a.fail(t.line, "Duplicate 'else'.")
+	}
+
+	// Jump from the end of the if block over the else block, and
+	// send the skipped jump at begin here instead.
+	jump := a.here
+	a.emit(t.line, 0x1000)
+	a.patchExits(f)
+	f.exits = []int{jump}
+	f.hasElse = true
+}
+
+// Parses `vx == n`, `vx != vy`, `vx key` and the like.
+func (a *assembler) condition() condition {
+	x := a.register(a.next())
+	op := a.next()
+
+	switch op.text {
+	case "key":
+		return condition{skipFalse: 0xe0a1 | x<<8, skipTrue: 0xe09e | x<<8}
+	case "-key":
+		return condition{skipFalse: 0xe09e | x<<8, skipTrue: 0xe0a1 | x<<8}
+	case "==", "!=":
+	default:
+		a.fail(op.line, fmt.Sprintf("Unsupported comparison %q.", op.text))
+	}
+
+	rhs := a.next()
+
+	var eq, ne uint16
+	if y, ok := a.registerIndex(rhs.text); ok {
+		eq, ne = 0x5000|x<<8|uint16(y)<<4, 0x9000|x<<8|uint16(y)<<4
+	} else {
+		n := uint16(a.byteValue(rhs))
+		eq, ne = 0x3000|x<<8|n, 0x4000|x<<8|n
+	}
+
+	// eq skips when the operands are equal and ne when they are not.
+	if op.text == "==" {
+		return condition{skipFalse: ne, skipTrue: eq}
+	}
+	return condition{skipFalse: eq, skipTrue: ne}
+}
+
+func (a *assembler) topFrame(t token, loop bool) *frame {
+	if len(a.frames) == 0 || a.frames[len(a.frames)-1].loop != loop {
+		a.fail(t.line, fmt.Sprintf("Unexpected %q.", t.text))
+	}
+
+	return a.frames[len(a.frames)-1]
+}
+
+// Returns the innermost open loop, which may hold if blocks that
+// are still open too.
+func (a *assembler) loopFrame(t token) *frame {
+	for i := len(a.frames) - 1; i >= 0; i-- {
+		if a.frames[i].loop {
+			return a.frames[i]
+		}
+	}
+
+	a.fail(t.line, fmt.Sprintf("Unexpected %q.", t.text))
+	return nil
+}
+
+func (a *assembler) popFrame(t token, loop bool) *frame {
+	f := a.topFrame(t, loop)
+	a.frames = a.frames[:len(a.frames)-1]
+
+	return f
+}
+
+// Points the frame's pending jumps at the current address.
+func (a *assembler) patchExits(f *frame) {
+	for _, addr := range f.exits {
+		a.mem[addr] = 0x10 | byte(a.here>>8)
+		a.mem[addr+1] = byte(a.here)
+	}
+}
+
+func (a *assembler) defineLabel(name token) {
+	a.checkName(name)
+	if _, ok := a.labels[name.text]; ok {
+		a.fail(name.line, fmt.Sprintf("Label %q is already defined.", name.text))
+	}
+
+	a.labels[name.text] = a.here
+}
+
+func (a *assembler) defineMacro() {
+	name := a.next()
+	a.checkName(name)
+
+	m := &macro{}
+	for {
+		t := a.next()
+		if t.text == "{" {
+			break
+		}
+		m.args = append(m.args, t.text)
+	}
+
+	for depth := 1; ; {
+		t := a.next()
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.body = append(m.body, t)
+	}
+
+	a.macros[name.text] = m
+}
+
+// Replaces a macro invocation with its body, substituting the
+// arguments that follow it.
+func (a *assembler) expandMacro(m *macro) {
+	args := map[string]string{}
+	for _, name := range m.args {
+		args[name] = a.next().text
+	}
+
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if v, ok := args[t.text]; ok {
+			t.text = v
+		}
+		body[i] = t
+	}
+
+	rest := append(body, a.toks[a.pos:]...)
+	a.toks = append(a.toks[:a.pos], rest...)
+}
+
+// Emits op with a 12 bit address, which may be a label that is
+// defined later.
+func (a *assembler) emitAddress(t token, op uint16) {
+	if n, ok := a.constant(t.text); ok {
+		if n < 0 || n > 0xfff {
+			a.fail(t.line, fmt.Sprintf("Address 0x%x is out of range.", n))
+		}
+		a.emit(t.line, op|uint16(n))
+		return
+	}
+
+	a.checkLabelRef(t)
+	a.fixups = append(a.fixups, fixup{addr: a.here, name: t.text, line: t.line, kind: fix12})
+	a.emit(t.line, op)
+}
+
+func (a *assembler) checkLabelRef(t token) {
+	if !validName(t.text) {
+		a.fail(t.line, fmt.Sprintf("Expected an address but got %q.", t.text))
+	}
+}
+
+func (a *assembler) checkName(t token) {
+	if !validName(t.text) {
+		a.fail(t.line, fmt.Sprintf("Invalid name %q.", t.text))
+	}
+	if isRegister(t.text) {
+		a.fail(t.line, fmt.Sprintf("Cannot redefine register %q.", t.text))
+	}
+}
+
+// Returns the register index for vx, or for an alias.
+func (a *assembler) registerIndex(s string) (int, bool) {
+	if r, ok := a.aliases[s]; ok {
+		return r, true
+	}
+
+	if isRegister(s) {
+		n, _ := strconv.ParseUint(s[1:], 16, 4)
+		return int(n), true
+	}
+
+	return 0, false
+}
+
+// Reports whether s names one of v0 to vf.
+func isRegister(s string) bool {
+	if len(s) != 2 || s[0] != 'v' && s[0] != 'V' {
+		return false
+	}
+
+	_, err := strconv.ParseUint(s[1:], 16, 4)
+	return err == nil
+}
+
+func (a *assembler) register(t token) uint16 {
+	r, ok := a.registerIndex(t.text)
+	if !ok {
+		a.fail(t.line, fmt.Sprintf("Expected a register but got %q.", t.text))
+	}
+
+	return uint16(r)
+}
+
+// Returns the value of a number literal, a constant or a label that
+// has already been defined.
+func (a *assembler) constant(s string) (int, bool) {
+	if n, ok := parseNumber(s); ok {
+		return n, true
+	}
+	if n, ok := a.consts[s]; ok {
+		return n, true
+	}
+	if n, ok := a.labels[s]; ok {
+		return n, true
+	}
+
+	return 0, false
+}
+
+func (a *assembler) value(t token) int {
+	n, ok := a.constant(t.text)
+	if !ok {
+		a.fail(t.line, fmt.Sprintf("Unknown value %q.", t.text))
+	}
+
+	return n
+}
+
+func (a *assembler) byteValue(t token) byte {
+	n := a.value(t)
+	if n < -128 || n > 0xff {
+		a.fail(t.line, fmt.Sprintf("Value %d does not fit in a byte.", n))
+	}
+
+	return byte(n)
+}
+
+func (a *assembler) nibble(t token) uint16 {
+	n := a.value(t)
+	if n < 0 || n > 0xf {
+		a.fail(t.line, fmt.Sprintf("Value %d does not fit in a nibble.", n))
+	}
+
+	return uint16(n)
+}
+
+// Parses decimal, 0x hex and 0b binary literals, which may be
+// negative.
+func parseNumber(s string) (int, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		base, s = 2, s[2:]
+	}
+
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	if neg {
+		n = -n
+	}
+
+	return int(n), true
+}
+
+func validName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' || s[0] == '-' {
+		return false
+	}
+
+	for _, c := range s {
+		ok := c == '_' || c == '-' || c == '.' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,39 @@
+package chip8
+
+// Receives the sound the vm makes, see WithAudio. It is called on
+// whichever goroutine drives the vm, so a sink playing audio on
+// another goroutine has to synchronise.
+type AudioSink interface {
+	// Called with true when the sound timer starts running and
+	// with false once it runs out.
+	Sound(on bool)
+
+	// Called on XO-CHIP when F002 loads the pattern buffer or FX3A
+	// sets the pitch, and on every platform when the vm is reset or
+	// a state is loaded. While the pattern is not all zeroes it
+	// should be played instead of a plain tone, one bit per sample
+	// at 4000*2^((pitch-64)/48) Hz.
+	Pattern(pattern [16]uint8, pitch uint8)
+}
+
+// Tells the sink when the sound timer starts or stops running.
+func (vm *VM) updateSound() {
+	on := vm.st > 0
+	if on == vm.sounding {
+		return
+	}
+
+	vm.sounding = on
+	if vm.audio != nil {
+		vm.audio.Sound(on)
+	}
+}
+
+// Tells the sink about a new XO-CHIP pattern or pitch. Other
+// platforms send theirs too, all zeroes, so a sink left with a
+// pattern from an XO-CHIP ROM goes back to a plain tone.
+func (vm *VM) updatePattern() {
+	if vm.audio != nil {
+		vm.audio.Pattern(vm.pattern, vm.pitch)
+	}
+}
@@ -0,0 +1,106 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+type recordingSink struct {
+	edges   []bool
+	pattern [16]uint8
+	pitch   uint8
+}
+
+func (s *recordingSink) Sound(on bool) {
+	s.edges = append(s.edges, on)
+}
+
+func (s *recordingSink) Pattern(pattern [16]uint8, pitch uint8) {
+	s.pattern, s.pitch = pattern, pitch
+}
+
+func TestSoundLastsAsLongAsTheTimer(t *testing.T) {
+	sink := &recordingSink{}
+	c8 := New(WithAudio(sink))
+	c8.registers[0] = 3
+
+	_ = c8.exec(0xf018)
+	if len(sink.edges) != 1 || !sink.edges[0] {
+		t.Fatalf("got %v", sink.edges)
+	}
+
+	c8.TickTimers()
+	c8.TickTimers()
+	if len(sink.edges) != 1 {
+		t.Fatalf("got %v", sink.edges)
+	}
+
+	c8.TickTimers()
+	c8.TickTimers()
+	if len(sink.edges) != 2 || sink.edges[1] {
+		t.Fatalf("got %v", sink.edges)
+	}
+}
+
+func TestZeroSoundTimerStopsSound(t *testing.T) {
+	sink := &recordingSink{}
+	c8 := New(WithAudio(sink))
+	c8.registers[0] = 10
+
+	_ = c8.exec(0xf018)
+	_ = c8.exec(0xf118)
+
+	if len(sink.edges) != 2 || sink.edges[1] {
+		t.Fatalf("got %v", sink.edges)
+	}
+}
+
+func TestSinkReceivesPattern(t *testing.T) {
+	sink := &recordingSink{}
+	xo := New(WithPlatform(XOChip), WithAudio(sink))
+	xo.ir = 0x400
+	xo.memory[0x40f] = 0xaa
+	xo.registers[1] = 112
+
+	_ = xo.exec(0xf002)
+	_ = xo.exec(0xf13a)
+
+	if sink.pattern[15] != 0xaa || sink.pitch != 112 {
+		t.Fail()
+	}
+
+	_ = xo.LoadRom(nil)
+	if sink.pattern != [16]uint8{} || sink.pitch != 64 {
+		t.Fail()
+	}
+}
+
+func TestSwitchingFromXOChipClearsPattern(t *testing.T) {
+	sink := &recordingSink{}
+	c8 := New(WithPlatform(XOChip), WithAudio(sink))
+	var saved bytes.Buffer
+	if err := New(WithPlatform(Chip8)).SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	c8.ir = 0x400
+	c8.memory[0x400] = 0xff
+	_ = c8.exec(0xf002)
+	if sink.pattern[0] != 0xff {
+		t.Fatal("pattern not sent")
+	}
+
+	c8.SetPlatform(Chip8, QuirksVIP)
+	if sink.pattern != [16]uint8{} || sink.pitch != 64 {
+		t.Errorf("SetPlatform left %x at pitch %d", sink.pattern, sink.pitch)
+	}
+
+	c8.SetPlatform(XOChip, QuirksXOChip)
+	_ = c8.exec(0xf002)
+	if err := c8.LoadState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if sink.pattern != [16]uint8{} || sink.pitch != 64 {
+		t.Errorf("LoadState left %x at pitch %d", sink.pattern, sink.pitch)
+	}
+}
@@ -0,0 +1,327 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Why RunUntilBreak returned.
+type StopKind uint8
+
+const (
+	// Ran every instruction it was asked to.
+	StopLimit StopKind = iota
+
+	// About to execute an instruction a breakpoint matches.
+	StopBreakpoint
+
+	// The last instruction touched memory a watchpoint covers.
+	StopWatchpoint
+
+	// The last instruction faulted.
+	StopFault
+
+	// The program has executed 00FD.
+	StopExit
+)
+
+func (k StopKind) String() string {
+	switch k {
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopWatchpoint:
+		return "watchpoint"
+	case StopFault:
+		return "fault"
+	case StopExit:
+		return "exit"
+	default:
+		return "limit"
+	}
+}
+
+// Describes where and why RunUntilBreak stopped.
+type StopReason struct {
+	Kind StopKind
+
+	// The program counter once stopped. For a breakpoint this is
+	// the instruction that has not run yet.
+	PC uint16
+
+	// The breakpoint or watchpoint that was hit.
+	ID int
+
+	// For watchpoints, the first watched address the instruction
+	// accessed and whether it was written to.
+	Addr  uint16
+	Write bool
+
+	// For faults, the *Fault returned by Cycle.
+	Err error
+}
+
+// Stops the vm before it executes an instruction. Every field that
+// is set has to match.
+type Breakpoint struct {
+	// The address of the instruction. Zero matches any address,
+	// since programs never run from there.
+	Addr uint16
+
+	// Matches opcodes where opcode&Mask == Match. A zero Mask
+	// matches any opcode. See OpcodeClass.
+	Mask  uint16
+	Match uint16
+
+	// Matches when it reports true. See ParseCondition.
+	Cond func(Registers) bool
+}
+
+// Stops the vm after an instruction reads or writes memory between
+// Start and End inclusive. Instruction fetches are not counted.
+type Watchpoint struct {
+	Start uint16
+	End   uint16
+	Read  bool
+	Write bool
+}
+
+type breakpoint struct {
+	id int
+	Breakpoint
+}
+
+type watchpoint struct {
+	id int
+	Watchpoint
+}
+
+var (
+	ErrInvalidCondition   = errors.New("Invalid breakpoint condition.")
+	ErrInvalidOpcodeClass = errors.New("Invalid opcode class.")
+)
+
+// Adds a breakpoint and returns its id.
+func (vm *VM) AddBreakpoint(b Breakpoint) int {
+	vm.nextBreakID++
+	vm.breakpoints = append(vm.breakpoints, breakpoint{vm.nextBreakID, b})
+
+	return vm.nextBreakID
+}
+
+// Adds a watchpoint and returns its id.
+func (vm *VM) AddWatchpoint(w Watchpoint) int {
+	vm.nextBreakID++
+	vm.watchpoints = append(vm.watchpoints, watchpoint{vm.nextBreakID, w})
+
+	return vm.nextBreakID
+}
+
+// Removes the breakpoint or watchpoint with the given id.
+func (vm *VM) RemoveBreakpoint(id int) {
+	for i, b := range vm.breakpoints {
+		if b.id == id {
+			vm.breakpoints = append(vm.breakpoints[:i], vm.breakpoints[i+1:]...)
+			return
+		}
+	}
+
+	for i, w := range vm.watchpoints {
+		if w.id == id {
+			vm.watchpoints = append(vm.watchpoints[:i], vm.watchpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// Removes every breakpoint and watchpoint.
+func (vm *VM) ClearBreakpoints() {
+	vm.breakpoints = nil
+	vm.watchpoints = nil
+}
+
+// Runs up to n instructions, stopping early at breakpoints,
+// watchpoints, faults and exit. The timers are left alone.
+//
+// Calling it again after stopping at a breakpoint carries on past
+// that breakpoint rather than stopping at it straight away.
+func (vm *VM) RunUntilBreak(n int) StopReason {
+	for i := 0; i < n; i++ {
+		if vm.exited {
+			return StopReason{Kind: StopExit, PC: vm.pc}
+		}
+
+		if !vm.resuming {
+			if id, ok := vm.breakpointHit(); ok {
+				vm.resuming = true
+				return StopReason{Kind: StopBreakpoint, PC: vm.pc, ID: id}
+			}
+		}
+
+		if err := vm.Cycle(); err != nil {
+			return StopReason{Kind: StopFault, PC: vm.pc, Err: err}
+		}
+
+		if vm.watchHit != nil {
+			r := *vm.watchHit
+			r.PC = vm.pc
+			return r
+		}
+	}
+
+	if vm.exited {
+		return StopReason{Kind: StopExit, PC: vm.pc}
+	}
+
+	return StopReason{Kind: StopLimit, PC: vm.pc}
+}
+
+// Returns the id of the first breakpoint matching the instruction
+// at the program counter.
+func (vm *VM) breakpointHit() (int, bool) {
+	if len(vm.breakpoints) == 0 || !vm.inBounds(vm.pc, 2) {
+		return 0, false
+	}
+
+	ins := vm.fetchInstruction()
+
+	for _, b := range vm.breakpoints {
+		if b.Addr != 0 && b.Addr != vm.pc {
+			continue
+		}
+		if ins&b.Mask != b.Match {
+			continue
+		}
+		if b.Cond != nil && !b.Cond(vm.Registers()) {
+			continue
+		}
+
+		return b.id, true
+	}
+
+	return 0, false
+}
+
+// Records an access of n bytes at addr by the executing
+// instruction if a watchpoint covers it.
+func (vm *VM) watch(addr uint16, n int, write bool) {
+	if vm.watchHit != nil || n <= 0 {
+		return
+	}
+
+	end := int(addr) + n - 1
+
+	for _, w := range vm.watchpoints {
+		if write && !w.Write || !write && !w.Read {
+			continue
+		}
+		if end < int(w.Start) || int(addr) > int(w.End) {
+			continue
+		}
+
+		vm.watchHit = &StopReason{
+			Kind:  StopWatchpoint,
+			ID:    w.id,
+			Addr:  max(addr, w.Start),
+			Write: write,
+		}
+		return
+	}
+}
+
+// Parses an opcode pattern such as "DXYN" or "8XY4" into a mask
+// and match for a Breakpoint. Hex digits have to match and any
+// other character matches anything.
+func OpcodeClass(pattern string) (mask, match uint16, err error) {
+	if len(pattern) != 4 {
+		return 0, 0, ErrInvalidOpcodeClass
+	}
+
+	for i, c := range strings.ToLower(pattern) {
+		shift := uint(12 - 4*i)
+
+		v, err := strconv.ParseUint(string(c), 16, 4)
+		if err != nil {
+			if c < 'g' || c > 'z' {
+				return 0, 0, ErrInvalidOpcodeClass
+			}
+			continue
+		}
+
+		mask |= 0xf << shift
+		match |= uint16(v) << shift
+	}
+
+	return mask, match, nil
+}
+
+// Parses a condition such as "V3 == 0x10" or "I >= 0x300" for a
+// Breakpoint. Either side can be a register (V0-VF, I, PC, SP, DT
+// or ST) or a number, compared with ==, !=, <, <=, > or >=.
+func ParseCondition(s string) (func(Registers) bool, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w %q", ErrInvalidCondition, s)
+	}
+
+	lhs, ok := conditionOperand(fields[0])
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidCondition, s)
+	}
+	rhs, ok := conditionOperand(fields[2])
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidCondition, s)
+	}
+
+	var cmp func(a, b int) bool
+	switch fields[1] {
+	case "==":
+		cmp = func(a, b int) bool { return a == b }
+	case "!=":
+		cmp = func(a, b int) bool { return a != b }
+	case "<":
+		cmp = func(a, b int) bool { return a < b }
+	case "<=":
+		cmp = func(a, b int) bool { return a <= b }
+	case ">":
+		cmp = func(a, b int) bool { return a > b }
+	case ">=":
+		cmp = func(a, b int) bool { return a >= b }
+	default:
+		return nil, fmt.Errorf("%w %q", ErrInvalidCondition, s)
+	}
+
+	return func(r Registers) bool {
+		return cmp(lhs(r), rhs(r))
+	}, nil
+}
+
+// Returns a function reading a register or returning a constant.
+func conditionOperand(s string) (func(Registers) int, bool) {
+	switch u := strings.ToUpper(s); {
+	case u == "I":
+		return func(r Registers) int { return int(r.I) }, true
+	case u == "PC":
+		return func(r Registers) int { return int(r.PC) }, true
+	case u == "SP":
+		return func(r Registers) int { return int(r.SP) }, true
+	case u == "DT":
+		return func(r Registers) int { return int(r.DT) }, true
+	case u == "ST":
+		return func(r Registers) int { return int(r.ST) }, true
+	case len(u) == 2 && u[0] == 'V':
+		x, err := strconv.ParseUint(u[1:], 16, 4)
+		if err != nil {
+			return nil, false
+		}
+		return func(r Registers) int { return int(r.V[x]) }, true
+	}
+
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return nil, false
+	}
+
+	return func(Registers) int { return int(v) }, true
+}
@@ -0,0 +1,120 @@
+package chip8
+
+import (
+	"errors"
+	"testing"
+)
+
+// v3 := 0x10, i := 0x300, bcd v3, sprite v0 v0 5, then loops
+// forever.
+var breakRom = []byte{0x63, 0x10, 0xa3, 0x00, 0xf3, 0x33, 0xd0, 0x05, 0x12, 0x08}
+
+func newBreakVM(t *testing.T) *VM {
+	t.Helper()
+
+	vm := New()
+	if err := vm.LoadRom(breakRom); err != nil {
+		t.Fatal(err)
+	}
+
+	return vm
+}
+
+func TestStopsAtAddressBreakpoint(t *testing.T) {
+	vm := newBreakVM(t)
+	id := vm.AddBreakpoint(Breakpoint{Addr: 0x204})
+
+	r := vm.RunUntilBreak(100)
+	if r.Kind != StopBreakpoint || r.PC != 0x204 || r.ID != id {
+		t.Fatalf("got %+v", r)
+	}
+
+	// Carries on past the breakpoint it stopped at.
+	r = vm.RunUntilBreak(100)
+	if r.Kind != StopLimit || r.PC != 0x208 {
+		t.Fatalf("got %+v", r)
+	}
+
+	vm.RemoveBreakpoint(id)
+	vm.reset()
+	_ = vm.LoadRom(breakRom)
+	if r = vm.RunUntilBreak(3); r.Kind != StopLimit || r.PC != 0x206 {
+		t.Fatalf("got %+v", r)
+	}
+}
+
+func TestStopsOnCondition(t *testing.T) {
+	vm := newBreakVM(t)
+
+	cond, err := ParseCondition("V3 == 0x10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.AddBreakpoint(Breakpoint{Cond: cond})
+
+	if r := vm.RunUntilBreak(100); r.Kind != StopBreakpoint || r.PC != 0x202 {
+		t.Fatalf("got %+v", r)
+	}
+
+	for _, s := range []string{"V3 = 1", "VG == 1", "I == foo", "V3 =="} {
+		if _, err := ParseCondition(s); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("%q: got %v", s, err)
+		}
+	}
+}
+
+func TestStopsOnOpcodeClass(t *testing.T) {
+	vm := newBreakVM(t)
+
+	mask, match, err := OpcodeClass("DXYN")
+	if err != nil || mask != 0xf000 || match != 0xd000 {
+		t.Fatalf("got %04x %04x %v", mask, match, err)
+	}
+	vm.AddBreakpoint(Breakpoint{Mask: mask, Match: match})
+
+	if r := vm.RunUntilBreak(100); r.Kind != StopBreakpoint || r.PC != 0x206 {
+		t.Fatalf("got %+v", r)
+	}
+
+	if _, _, err := OpcodeClass("D!YN"); err != ErrInvalidOpcodeClass {
+		t.Fail()
+	}
+}
+
+func TestStopsOnWatchpoints(t *testing.T) {
+	vm := newBreakVM(t)
+	vm.AddWatchpoint(Watchpoint{Start: 0x301, End: 0x310, Write: true})
+
+	r := vm.RunUntilBreak(100)
+	if r.Kind != StopWatchpoint || r.PC != 0x206 || r.Addr != 0x301 || !r.Write {
+		t.Fatalf("got %+v", r)
+	}
+
+	vm.ClearBreakpoints()
+	vm.reset()
+	_ = vm.LoadRom(breakRom)
+	vm.AddWatchpoint(Watchpoint{Start: 0x300, End: 0x300, Read: true})
+
+	// The bcd write is ignored, the sprite read is not.
+	r = vm.RunUntilBreak(100)
+	if r.Kind != StopWatchpoint || r.PC != 0x208 || r.Addr != 0x300 || r.Write {
+		t.Fatalf("got %+v", r)
+	}
+}
+
+func TestStopsOnFaultAndExit(t *testing.T) {
+	vm := New(WithPlatform(SuperChip))
+	_ = vm.LoadRom([]byte{0x00, 0xfd})
+
+	if r := vm.RunUntilBreak(10); r.Kind != StopExit {
+		t.Fatalf("got %+v", r)
+	}
+
+	vm = New()
+	_ = vm.LoadRom([]byte{0x00, 0xee})
+
+	r := vm.RunUntilBreak(10)
+	if r.Kind != StopFault || !errors.Is(r.Err, ErrStackUnderflow) {
+		t.Fatalf("got %+v", r)
+	}
+}
@@ -0,0 +1,159 @@
+package chip8_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oliveira-a/gochip/chip8"
+	"github.com/oliveira-a/gochip/chip8/asm"
+	"github.com/oliveira-a/gochip/headless"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden images in testdata/golden.")
+
+// The test ROMs in testdata/roms, each run to a frame count under
+// a quirks preset and compared with testdata/golden/<name>.png.
+var conformance = []struct {
+	name   string
+	rom    string
+	quirks string
+	frames int
+}{
+	{"flags", "flags", "vip", 10},
+	{"quirks-vip", "quirks", "vip", 10},
+	{"quirks-chip48", "quirks", "chip48", 10},
+	{"quirks-schip", "quirks", "schip-modern", 10},
+	{"bcd", "bcd", "vip", 10},
+	{"subroutines", "subroutines", "vip", 10},
+	{"keypad", "keypad", "vip", 12},
+	{"display-clip", "display", "vip", 10},
+	{"display-wrap", "display", "xochip", 10},
+}
+
+func TestConformance(t *testing.T) {
+	for _, tc := range conformance {
+		t.Run(tc.name, func(t *testing.T) {
+			got := runConformanceRom(t, tc.rom, tc.quirks, tc.frames)
+			golden := filepath.Join("testdata", "golden", tc.name+".png")
+
+			if *update {
+				writePNG(t, golden, got)
+				return
+			}
+
+			f, err := os.Open(golden)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			defer f.Close()
+
+			want, err := png.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := diffImages(got, want); diff != "" {
+				actual := filepath.Join(t.TempDir(), tc.name+".png")
+				writePNG(t, actual, got)
+				t.Fatalf("frame differs from %s, got %s:\n%s", golden, actual, diff)
+			}
+		})
+	}
+}
+
+func runConformanceRom(t *testing.T, name, quirks string, frames int) image.Image {
+	t.Helper()
+
+	rom, err := asm.ReadFile(filepath.Join("testdata", "roms", name+".8o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := chip8.ParseQuirks(quirks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := chip8.New(chip8.WithQuirks(q), chip8.WithSeed(1))
+	if err := vm.LoadRom(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := headless.Options{Frames: frames, IPF: 100}
+	if f, err := os.Open(filepath.Join("testdata", "roms", name+".keys")); err == nil {
+		opts.Script, err = headless.ParseScript(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var img image.Image
+	err = headless.Run(vm, opts, func(_ int, vm *chip8.VM) error {
+		img = headless.Image(vm, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+// Returns an empty string if the images match, otherwise both
+// drawn as ASCII side by side with the differing rows marked.
+func diffImages(got, want image.Image) string {
+	if got.Bounds() != want.Bounds() {
+		return fmt.Sprintf("got size %v, want %v", got.Bounds(), want.Bounds())
+	}
+
+	var sb strings.Builder
+	same := true
+	b := got.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var g, w []byte
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g = append(g, pixelChar(got, x, y))
+			w = append(w, pixelChar(want, x, y))
+		}
+
+		marker := "  "
+		if !bytes.Equal(g, w) {
+			marker = "! "
+			same = false
+		}
+		fmt.Fprintf(&sb, "%s%s  %s\n", marker, g, w)
+	}
+
+	if same {
+		return ""
+	}
+
+	return sb.String()
+}
+
+func pixelChar(img image.Image, x, y int) byte {
+	c := headless.Palette.Index(img.At(x, y))
+	return ".#+@"[c]
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
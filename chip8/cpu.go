@@ -2,31 +2,42 @@ package chip8
 
 import (
 	"errors"
-	"fmt"
-	"log"
-	"math/rand"
 	"time"
 )
 
+// For VM.waitKey when FX0A is not waiting on a key.
+const noKey = -1
+
 const (
 	Cols = 64
 	Rows = 32
-)
 
-var debug bool
+	// The SUPER-CHIP hi-res display doubles both dimensions.
+	HiResCols = 128
+	HiResRows = 64
+)
 
 type VM struct {
-	Vram [Cols][Rows]uint8
+	// Sized for the hi-res mode. Only the top left Cols x Rows
+	// pixels are used in lo-res, see Frame.
+	display Frame
 
-	memory    [4096]uint8
+	// Sized for XO-CHIP. Other platforms only use the first
+	// 4 KiB, see Platform.MemorySize.
+	memory    [0x10000]uint8
 	registers [16]uint8
 	stack     [16]uint16
 
-	Keys [16]uint8
+	Keypad Keypad
 
-	// To be provided by the client.
-	// The vm will use this channel to notify when to beep.
-	audio chan int
+	// The key FX0A saw pressed and is waiting to be released, or
+	// noKey.
+	waitKey int8
+
+	// To be provided by the client, see WithAudio. sounding
+	// tracks what it was last told.
+	audio    AudioSink
+	sounding bool
 
 	// The program counter.
 	pc uint16
@@ -42,18 +53,68 @@ type VM struct {
 
 	// The sound timer.
 	st uint8
-}
 
-func init() {
-	log.SetPrefix("CHIP-8: ")
-	log.SetFlags(log.Ltime)
-}
+	// Which CHIP-8 flavour we are emulating.
+	platform Platform
+
+	// The ambiguous behaviours to follow, and whether they were
+	// given by WithQuirks rather than left to the platform default.
+	quirks    Quirks
+	quirksSet bool
+
+	// Feeds CXNN.
+	rand rng
+
+	// The HP48 RPL user flags used by FX75 and FX85. These
+	// survive a reset just like they did on the calculator.
+	rpl [16]uint8
+
+	// Set once the program executes 00FD.
+	exited bool
+
+	// The XO-CHIP drawing planes selected by FN01 as a bitmask.
+	planes uint8
 
-func New(audio chan int, debugMode bool) *VM {
-	debug = debugMode
+	// The XO-CHIP 1-bit audio samples loaded by F002 and the
+	// pitch register set by FX3A.
+	pattern [16]uint8
+	pitch   uint8
 
+	// See breakpoints.go.
+	breakpoints []breakpoint
+	watchpoints []watchpoint
+	nextBreakID int
+
+	// Set by a watchpoint during the current instruction.
+	watchHit *StopReason
+
+	// Set when stopped at a breakpoint so the next RunUntilBreak
+	// executes the instruction instead of stopping again.
+	resuming bool
+
+	// Receives an event per instruction when set, see WithTracer.
+	tracer Tracer
+
+	// The instructions decoded so far, one per address. See
+	// decode.go.
+	cache []decoded
+}
+
+// Returns a vm configured by the given options. Without any it
+// emulates the original CHIP-8 with its default quirks, see
+// WithPlatform and WithQuirks.
+func New(opts ...Option) *VM {
 	vm := &VM{
-		audio: audio,
+		platform: Chip8,
+		rand:     rng{state: uint64(time.Now().UnixNano())},
+	}
+
+	for _, opt := range opts {
+		opt(vm)
+	}
+
+	if !vm.quirksSet {
+		vm.quirks = DefaultQuirks(vm.platform)
 	}
 
 	vm.reset()
@@ -68,24 +129,68 @@ func (vm *VM) reset() {
 	vm.sp = 0
 	vm.dt = 0
 	vm.st = 0
+	vm.exited = false
+	vm.waitKey = noKey
+	vm.resuming = false
+	vm.planes = 1
+	vm.pattern = [16]uint8{}
+	vm.pitch = 64
+	vm.updateSound()
+	vm.updatePattern()
 
 	// ensure memory is cleared
-	for i := vm.pc; i < uint16(len(vm.memory)); i++ {
-		vm.memory[uint16(i)] = 0
+	for i := int(vm.pc); i < len(vm.memory); i++ {
+		vm.memory[i] = 0
 	}
 
-	// ensure vram is cleared
-	for y := 0; y < Rows; y++ {
-		for x := 0; x < Cols; x++ {
-			vm.Vram[x][y] = 0
-		}
-	}
+	// ensure the display is cleared on every plane
+	vm.display = Frame{Dirty: true}
 
 	copy(vm.memory[0:len(font)], font[:])
+	copy(vm.memory[bigFontAddr:bigFontAddr+len(bigFont)], bigFont[:])
+
+	vm.invalidateAll()
+}
+
+// Returns the platform the vm was created for.
+func (vm *VM) Platform() Platform {
+	return vm.platform
+}
+
+// Returns the quirks the vm was created with.
+func (vm *VM) Quirks() Quirks {
+	return vm.quirks
+}
+
+// Switches to another platform and quirks, such as when the next
+// ROM was written for a different one. The vm is reset.
+func (vm *VM) SetPlatform(p Platform, q Quirks) {
+	vm.platform = p
+	vm.quirks = q
+	vm.quirksSet = true
+	vm.reset()
+}
+
+// Returns the width and height of the display in the current
+// resolution.
+func (vm *VM) Resolution() (int, int) {
+	return vm.display.Size()
+}
+
+// Returns the XO-CHIP audio pattern buffer and the pitch
+// register. The pattern is played back one bit per sample at
+// 4000*2^((pitch-64)/48) Hz.
+func (vm *VM) AudioPattern() ([16]uint8, uint8) {
+	return vm.pattern, vm.pitch
+}
+
+// Reports whether the program has quit with 00FD.
+func (vm *VM) Exited() bool {
+	return vm.exited
 }
 
 func (vm *VM) LoadRom(b []byte) error {
-	if len(b) > len(vm.memory)-512 {
+	if len(b) > vm.platform.MemorySize()-512 {
 		return errors.New("Rom buffer has exceeded the maximum size.")
 	}
 
@@ -95,33 +200,78 @@ func (vm *VM) LoadRom(b []byte) error {
 	for i := 0; i < len(b); i++ {
 		vm.memory[vm.pc+uint16(i)] = b[i]
 	}
+	vm.invalidate(vm.pc, len(b))
 
 	return nil
 }
 
+// Executes a single instruction. The timers are left alone, see
+// TickTimers.
 func (vm *VM) Cycle() error {
-	err := vm.exec(vm.fetchInstruction())
-	if err != nil {
-		return err
+	if vm.exited {
+		return nil
 	}
 
+	vm.resuming = false
+	vm.watchHit = nil
+
+	if !vm.inBounds(vm.pc, 2) {
+		return vm.fault(ErrMemoryBounds, 0)
+	}
+
+	vm.Keypad.update()
+
+	if vm.tracer != nil {
+		return vm.traceExec(vm.fetchInstruction())
+	}
+
+	return vm.execDecoded()
+}
+
+// Decrements the delay and sound timers. Should be called at
+// 60 Hz no matter how many instructions run in between.
+func (vm *VM) TickTimers() {
 	if vm.dt > 0 {
 		vm.dt--
 	}
 
 	if vm.st > 0 {
-		select {
-		case vm.audio <- 1:
-		default:
-		}
 		vm.st--
+		vm.updateSound()
 	}
+}
+
+// Runs one 60 Hz frame: ipf instructions followed by a single
+// timer tick.
+func (vm *VM) RunFrame(ipf int) error {
+	for i := 0; i < ipf && !vm.exited; i++ {
+		if err := vm.Cycle(); err != nil {
+			return err
+		}
+	}
+
+	vm.TickTimers()
 
 	return nil
 }
 
+// Returns how far a conditional skip moves the program counter.
+// On XO-CHIP the skip has to jump over the whole of a 4 byte
+// F000 NNNN instruction.
+func (vm *VM) skipLength() uint16 {
+	if vm.platform >= XOChip && vm.fetchInstructionAt(vm.pc+2) == 0xf000 {
+		return 6
+	}
+
+	return 4
+}
+
 func (vm *VM) fetchInstruction() uint16 {
-	return uint16(vm.memory[vm.pc])<<8 | uint16(vm.memory[vm.pc+1])
+	return vm.fetchInstructionAt(vm.pc)
+}
+
+func (vm *VM) fetchInstructionAt(addr uint16) uint16 {
+	return uint16(vm.memory[addr])<<8 | uint16(vm.memory[addr+1])
 }
 
 func (vm *VM) exec(ins uint16) error {
@@ -136,223 +286,330 @@ func (vm *VM) exec(ins uint16) error {
 
 	switch opcode {
 	case 0x0000:
-		switch ins {
-		case 0x00E0:
-			logInstruction(ins, "Clear the display.")
-			for y := 0; y < Rows; y++ {
-				for x := 0; x < Cols; x++ {
-					vm.Vram[x][y] = 0
-				}
-			}
+		schip := vm.platform >= SuperChip
+
+		switch {
+		case ins == 0x00E0:
+			// Clear the display.
+			vm.clearScreen()
 			vm.pc += 2
-		case 0x00EE:
-			logInstruction(ins, "Return from a subroutine.")
-			vm.pc = vm.stack[vm.sp] + 2
+		case ins == 0x00EE:
+			// Return from a subroutine.
+			if vm.sp == 0 {
+				return vm.fault(ErrStackUnderflow, ins)
+			}
 			vm.sp--
+			vm.pc = vm.stack[vm.sp] + 2
+		case vm.platform >= XOChip && ins&0xfff0 == 0x00d0:
+			// Scroll the display up n lines.
+			vm.scroll(0, -int(n))
+			vm.pc += 2
+		case schip && ins&0xfff0 == 0x00c0:
+			// Scroll the display down n lines.
+			vm.scroll(0, int(n))
+			vm.pc += 2
+		case schip && ins == 0x00fb:
+			// Scroll the display right 4 pixels.
+			vm.scroll(4, 0)
+			vm.pc += 2
+		case schip && ins == 0x00fc:
+			// Scroll the display left 4 pixels.
+			vm.scroll(-4, 0)
+			vm.pc += 2
+		case schip && ins == 0x00fd:
+			// Exit the interpreter.
+			vm.exited = true
+		case schip && ins == 0x00fe:
+			// Switch to lo-res mode.
+			vm.display.setHires(false, vm.quirks.ResolutionChangeClears)
+			vm.pc += 2
+		case schip && ins == 0x00ff:
+			// Switch to hi-res mode.
+			vm.display.setHires(true, vm.quirks.ResolutionChangeClears)
+			vm.pc += 2
+		default:
+			return vm.fault(ErrUnknownOpcode, ins)
 		}
 	case 0x1000:
-		logInstruction(ins, "Jump to the location.")
+		// Jump to the location.
 		vm.pc = nnn
 	case 0x2000:
-		logInstruction(ins, "Call a subroutine.")
-		vm.sp += 1
+		// Call a subroutine.
+		if int(vm.sp) == len(vm.stack) {
+			return vm.fault(ErrStackOverflow, ins)
+		}
 		vm.stack[vm.sp] = vm.pc
+		vm.sp++
 		vm.pc = nnn
 	case 0x3000:
-		logInstruction(ins, "Skip the next instruction if vX = nn.")
+		// Skip the next instruction if vX = nn.
 		if uint16(vm.registers[vX]) == nn {
-			vm.pc += 4
+			vm.pc += vm.skipLength()
 		} else {
 			vm.pc += 2
 		}
 	case 0x4000:
-		logInstruction(ins, "Skip the next instrunction if vX != nn.")
+		// Skip the next instruction if vX != nn.
 		if uint16(vm.registers[vX]) != nn {
-			vm.pc += 4
+			vm.pc += vm.skipLength()
 		} else {
 			vm.pc += 2
 		}
 	case 0x5000:
-		logInstruction(ins, "Skip the next instrunction if vX != vY.")
-		if uint16(vm.registers[vX]) == uint16(vm.registers[vY]) {
-			vm.pc += 4
-		} else {
+		xo := vm.platform >= XOChip
+
+		switch {
+		case xo && n == 0x2:
+			// Store registers vX through vY in memory starting at location I.
+			if !vm.inBounds(vm.ir, len(registerRange(vX, vY))) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
+			for i, r := range registerRange(vX, vY) {
+				vm.memory[vm.ir+uint16(i)] = vm.registers[r]
+			}
+			vm.invalidate(vm.ir, len(registerRange(vX, vY)))
+			vm.watch(vm.ir, len(registerRange(vX, vY)), true)
+			vm.pc += 2
+		case xo && n == 0x3:
+			// Read registers vX through vY from memory starting at location I.
+			if !vm.inBounds(vm.ir, len(registerRange(vX, vY))) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
+			for i, r := range registerRange(vX, vY) {
+				vm.registers[r] = vm.memory[vm.ir+uint16(i)]
+			}
+			vm.watch(vm.ir, len(registerRange(vX, vY)), false)
 			vm.pc += 2
+		case n == 0x0:
+			// Skip the next instruction if vX != vY.
+			if uint16(vm.registers[vX]) == uint16(vm.registers[vY]) {
+				vm.pc += vm.skipLength()
+			} else {
+				vm.pc += 2
+			}
+		default:
+			return vm.fault(ErrUnknownOpcode, ins)
 		}
 	case 0x6000:
-		logInstruction(ins, "Load value nn into vX.")
+		// Load value nn into vX.
 		vm.registers[vX] = uint8(nn)
 		vm.pc += 2
 	case 0x7000:
-		logInstruction(ins, "Set vX = vX + nn.")
+		// Set vX = vX + nn.
 		vm.registers[vX] += uint8(nn)
 		vm.pc += 2
 	case 0x8000:
 		switch n {
 		case 0x0:
-			logInstruction(ins, "Set vX = vY.")
+			// Set vX = vY.
 			vm.registers[vX] = vm.registers[vY]
 			vm.pc += 2
 		case 0x1:
-			logInstruction(ins, "Set vX |= vY.")
+			// Set vX |= vY.
 			vm.registers[vX] |= vm.registers[vY]
+			if vm.quirks.LogicResetsVF {
+				vm.registers[0xf] = 0
+			}
 			vm.pc += 2
 		case 0x2:
-			logInstruction(ins, "Set vX &= vY.")
+			// Set vX &= vY.
 			vm.registers[vX] &= vm.registers[vY]
+			if vm.quirks.LogicResetsVF {
+				vm.registers[0xf] = 0
+			}
 			vm.pc += 2
 		case 0x3:
-			logInstruction(ins, "Set vX ^= vY.")
+			// Set vX ^= vY.
 			vm.registers[vX] ^= vm.registers[vY]
+			if vm.quirks.LogicResetsVF {
+				vm.registers[0xf] = 0
+			}
 			vm.pc += 2
 		case 0x4:
-			logInstruction(ins, "Set vX = vX + vY, set VF = carry.")
+			// Set vX = vX + vY, set VF = carry. The flag is
+			// written last so it wins when X is F.
 			var r uint16 = uint16(vm.registers[vX]) + uint16(vm.registers[vY])
-			if r > 0xff {
-				vm.registers[0xf] = 1
-			} else {
-				vm.registers[0xf] = 0
-			}
 			vm.registers[vX] = uint8(r & 0x00ff)
+			vm.registers[0xf] = uint8(r >> 8)
 			vm.pc += 2
 		case 0x5:
-			logInstruction(ins, "Set vX = vX - vY, set VF = NOT borrow.")
-			if vm.registers[vX] > vm.registers[vY] {
-				vm.registers[0xf] = 1
-			} else {
-				vm.registers[0xf] = 0
-			}
-			vm.registers[vX] -= vm.registers[vY]
+			// Set vX = vX - vY, set VF = NOT borrow.
+			x, y := vm.registers[vX], vm.registers[vY]
+			vm.registers[vX] = x - y
+			vm.registers[0xf] = btoi(x >= y)
 			vm.pc += 2
 		case 0x6:
-			logInstruction(ins, "Set vX = vX SHR 1.")
-			vm.registers[0xf] = vm.registers[vX] & 1
+			// Set vX = vX SHR 1.
+			if vm.quirks.ShiftUsesVY {
+				vm.registers[vX] = vm.registers[vY]
+			}
+			flag := vm.registers[vX] & 1
 			vm.registers[vX] /= 2
+			vm.registers[0xf] = flag
 			vm.pc += 2
 		case 0x7:
-			logInstruction(ins, "Set vX = vX - vY, set VF = NOT borrow.")
-			if vm.registers[vY] > vm.registers[vX] {
-				vm.registers[0xf] = 1
-			} else {
-				vm.registers[0xf] = 0
-			}
-			vm.registers[vX] = vm.registers[vY] - vm.registers[vX]
+			// Set vX = vY - vX, set VF = NOT borrow.
+			x, y := vm.registers[vX], vm.registers[vY]
+			vm.registers[vX] = y - x
+			vm.registers[0xf] = btoi(y >= x)
 			vm.pc += 2
 		case 0xe:
-			logInstruction(ins, "Set vX = vX SHL 1.")
-			vm.registers[0xf] = vm.registers[vX] >> 7
+			// Set vX = vX SHL 1.
+			if vm.quirks.ShiftUsesVY {
+				vm.registers[vX] = vm.registers[vY]
+			}
+			flag := vm.registers[vX] >> 7
 			vm.registers[vX] *= 2
+			vm.registers[0xf] = flag
 			vm.pc += 2
+		default:
+			return vm.fault(ErrUnknownOpcode, ins)
 		}
 	case 0x9000:
-		logInstruction(ins, "Skip next instrunction if vX != vY.")
+		if n != 0 {
+			return vm.fault(ErrUnknownOpcode, ins)
+		}
+
+		// Skip next instruction if vX != vY.
 		if vm.registers[vX] != vm.registers[vY] {
-			vm.pc += 4
+			vm.pc += vm.skipLength()
 		} else {
 			vm.pc += 2
 		}
 	case 0xa000:
-		logInstruction(ins, "Set vI to nnn.")
+		// Set vI to nnn.
 		vm.ir = nnn
 		vm.pc += 2
 	case 0xb000:
-		logInstruction(ins, "Jump to location nnn + v0.")
-		vm.pc = uint16(vm.registers[0]) + nnn
-	case 0xc000:
-		logInstruction(ins, "Set vX = random byte AND nn.")
-		s := rand.NewSource(time.Now().UnixMilli())
-		r := rand.New(s)
-		num := uint16(r.Intn(255))
-
-		val := uint8(num & nn)
-		if vm.registers[vX] != val {
-			vm.registers[vX] = val
+		if vm.quirks.JumpUsesVX {
+			// Jump to location xnn + vX.
+			vm.pc = uint16(vm.registers[vX]) + nnn
+		} else {
+			// Jump to location nnn + v0.
+			vm.pc = uint16(vm.registers[0]) + nnn
 		}
+	case 0xc000:
+		// Set vX = random byte AND nn.
+		vm.registers[vX] = vm.rand.byte() & uint8(nn)
 		vm.pc += 2
 	case 0xd000:
-		logInstruction(ins, "Draw.")
-
-		vm.registers[0xf] = 0
-		height := n
-
-		for i := 0; i < int(height); i++ {
-			sprite := vm.memory[vm.ir+uint16(i)]
-
-			for bit := 0; bit < 8; bit++ {
-				draw := (sprite >> (8 - (bit + 1))) % 2
-				x, y := (vm.registers[vX]+uint8(bit))%Cols, (vm.registers[vY]+uint8(i))%Rows
-
-				vm.Vram[x][y] ^= draw
+		// Draw an 8xN sprite, or a 16x16 one for DXY0 on
+		// SUPER-CHIP.
+		w, h := 8, int(n)
+		if n == 0 && vm.platform >= SuperChip {
+			w, h = 16, 16
+		}
 
-				// If any bit got erased, then set vF to carry.
-				if vm.Vram[x][y] == 0 {
-					vm.registers[0xf] = 1
-				}
-			}
+		if !vm.inBounds(vm.ir, vm.spriteSize(w, h)) {
+			return vm.fault(ErrMemoryBounds, ins)
 		}
+
+		vm.watch(vm.ir, vm.spriteSize(w, h), false)
+		vm.draw(vm.registers[vX], vm.registers[vY], w, h)
 		vm.pc += 2
 	case 0xe000:
 		switch nn {
 		case 0x9e:
-			logInstruction(ins, "Skip next instrunction if key with value of vX is pressed.")
-			if vm.Keys[vm.registers[vX]] == 1 {
-				vm.pc += 4
+			// Skip next instruction if key with value of vX is pressed.
+			if vm.Keypad.IsPressed(Key(vm.registers[vX])) {
+				vm.pc += vm.skipLength()
 			} else {
 				vm.pc += 2
 			}
 		case 0xa1:
-			logInstruction(ins, "Skip next instrunction if key with value of vX is not pressed.")
-			if vm.Keys[vm.registers[vX]] == 0 {
-				vm.pc += 4
+			// Skip next instruction if key with value of vX is not pressed.
+			if !vm.Keypad.IsPressed(Key(vm.registers[vX])) {
+				vm.pc += vm.skipLength()
 			} else {
 				vm.pc += 2
 			}
+		default:
+			return vm.fault(ErrUnknownOpcode, ins)
 		}
 	case 0xf000:
-		switch nn {
-		case 0x7:
-			logInstruction(ins, "Set vX = delay timer value.")
+		schip := vm.platform >= SuperChip
+		xo := vm.platform >= XOChip
+
+		switch {
+		case xo && ins == 0xf000:
+			// Set I = the 16 bit address nnnn that follows.
+			if !vm.inBounds(vm.pc, 4) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
+			vm.ir = vm.fetchInstructionAt(vm.pc + 2)
+			vm.pc += 4
+		case xo && nn == 0x01:
+			// Select the drawing planes x.
+			vm.planes = uint8(vX) & 0x3
+			vm.pc += 2
+		case xo && ins == 0xf002:
+			// Load 16 bytes starting at I into the audio pattern buffer.
+			if !vm.inBounds(vm.ir, len(vm.pattern)) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
+			for i := range vm.pattern {
+				vm.pattern[i] = vm.memory[vm.ir+uint16(i)]
+			}
+			vm.watch(vm.ir, len(vm.pattern), false)
+			vm.updatePattern()
+			vm.pc += 2
+		case xo && nn == 0x3a:
+			// Set the audio pitch register to vX.
+			vm.pitch = vm.registers[vX]
+			vm.updatePattern()
+			vm.pc += 2
+		case nn == 0x7:
+			// Set vX = delay timer value.
 			vm.registers[vX] = uint8(vm.dt)
 			vm.pc += 2
-		case 0xa:
-			logInstruction(ins, "Wait kor a key press. Store the value of the key in vX.")
-			for i, k := range vm.Keys {
-				if k == 1 {
-					vm.registers[vX] = uint8(i)
-					vm.Keys[i] = 0
-					vm.pc += 2
+		case nn == 0xa:
+			// Wait for a key to be pressed and released, like the
+			// COSMAC VIP did. Store the value of the key in vX.
+			// The instruction repeats until then.
+			switch {
+			case vm.waitKey == noKey:
+				for k := Key(0); k < 16; k++ {
+					if vm.Keypad.IsPressed(k) {
+						vm.waitKey = int8(k)
+						break
+					}
 				}
+			case !vm.Keypad.IsPressed(Key(vm.waitKey)):
+				vm.registers[vX] = uint8(vm.waitKey)
+				vm.waitKey = noKey
+				vm.pc += 2
 			}
-		case 0x15:
-			logInstruction(ins, "Set the delay timer to vX.")
+		case nn == 0x15:
+			// Set the delay timer to vX.
 			vm.dt = vm.registers[vX]
 			vm.pc += 2
-		case 0x18:
-			logInstruction(ins, "Set sound timer = vX.")
+		case nn == 0x18:
+			// Set sound timer = vX.
 			vm.st = vm.registers[vX]
+			vm.updateSound()
 			vm.pc += 2
-		case 0x1e:
-			logInstruction(ins, "Set I = I + vX.")
+		case nn == 0x1e:
+			// Set I = I + vX.
 			vm.ir += uint16(vm.registers[vX])
-			if vm.ir > 0xfff {
+			if vm.quirks.IndexOverflowSetsVF && vm.ir > 0xfff {
 				vm.registers[0xf] = 1
 			}
 			vm.pc += 2
-		case 0x29:
-			// Find the character in the font map
-			// Set the ir to point to the right
-			// address memory which corresponds to
-			// the character in register x. Each
-			// character is at 5 apart.
-			logInstruction(ins, "Set I = location of sprite for digit vX.")
-			p := 0
-			for i := 0; i < int(vm.registers[vX]); i++ {
-				p += 5
-			}
-			vm.ir = uint16(p)
+		case nn == 0x29:
+			// Set I = location of sprite for digit vX. Only
+			// the low nibble of vX is used.
+			vm.ir = uint16(vm.registers[vX]&0xf) * 5
+			vm.pc += 2
+		case schip && nn == 0x30:
+			// Set I = location of big sprite for digit vX.
+			vm.ir = uint16(bigFontAddr) + uint16(vm.registers[vX]&0xf)*10
 			vm.pc += 2
-		case 0x33:
-			logInstruction(ins, "Store BCD representation of vX in memory location I, I+1, and I+2")
+		case nn == 0x33:
+			// Store BCD representation of vX in memory location I, I+1, and I+2
+			if !vm.inBounds(vm.ir, 3) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
+
 			// 128
 			v := vm.registers[vX]
 
@@ -362,28 +619,147 @@ func (vm *VM) exec(ins uint16) error {
 			vm.memory[vm.ir] = b
 			vm.memory[vm.ir+1] = c
 			vm.memory[vm.ir+2] = d
+			vm.invalidate(vm.ir, 3)
+			vm.watch(vm.ir, 3, true)
 
 			vm.pc += 2
-		case 0x55:
-			logInstruction(ins, "Store registers v0 through vX in memory locations I.")
+		case nn == 0x55:
+			// Store registers v0 through vX in memory locations I.
+			if !vm.inBounds(vm.ir, int(vX)+1) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
 			for r := 0; r <= int(vX); r++ {
 				vm.memory[vm.ir+uint16(r)] = vm.registers[r]
 			}
+			vm.invalidate(vm.ir, int(vX)+1)
+			vm.watch(vm.ir, int(vX)+1, true)
+			vm.incrementIndex(vX)
 			vm.pc += 2
-		case 0x65:
-			logInstruction(ins, "Read registers v0 through vX from memory starting at location I.")
+		case nn == 0x65:
+			// Read registers v0 through vX from memory starting at location I.
+			if !vm.inBounds(vm.ir, int(vX)+1) {
+				return vm.fault(ErrMemoryBounds, ins)
+			}
 			for i := 0; i <= int(vX); i++ {
 				vm.registers[i] = vm.memory[vm.ir+uint16(i)]
 			}
+			vm.watch(vm.ir, int(vX)+1, false)
+			vm.incrementIndex(vX)
 			vm.pc += 2
+		case schip && nn == 0x75:
+			// Store registers v0 through vX in the RPL flags.
+			copy(vm.rpl[:vX+1], vm.registers[:vX+1])
+			vm.pc += 2
+		case schip && nn == 0x85:
+			// Read registers v0 through vX from the RPL flags.
+			copy(vm.registers[:vX+1], vm.rpl[:vX+1])
+			vm.pc += 2
+		default:
+			return vm.fault(ErrUnknownOpcode, ins)
 		}
 	default:
-		return fmt.Errorf("Unsupported instruction: %04x", ins)
+		return vm.fault(ErrUnknownOpcode, ins)
 	}
 
 	return nil
 }
 
+// Returns how many bytes of memory a w by h sprite takes up on
+// the selected planes.
+func (vm *VM) spriteSize(w, h int) int {
+	size := 0
+	for plane := uint8(1); plane <= 2; plane <<= 1 {
+		if vm.planes&plane != 0 {
+			size += w / 8 * h
+		}
+	}
+
+	return size
+}
+
+// XORs a w by h sprite read from I onto the display at (x, y).
+// The sprite wraps around the edges unless the clip quirk is set,
+// though its origin always wraps. 16 pixel wide sprites use two bytes
+// per row. On XO-CHIP the sprite is drawn once per selected
+// plane, each plane reading the next sprite in memory. VF is set
+// if any lit pixel gets erased.
+func (vm *VM) draw(x, y uint8, w, h int) {
+	cols, rows := vm.Resolution()
+	bytesPerRow := w / 8
+	addr := vm.ir
+	ox, oy := int(x)%cols, int(y)%rows
+
+	vm.registers[0xf] = 0
+
+	for plane := 0; plane < 2; plane++ {
+		if vm.planes&(1<<plane) == 0 {
+			continue
+		}
+
+		for r := 0; r < h; r++ {
+			py := oy + r
+			if py >= rows {
+				if vm.quirks.Clip {
+					break
+				}
+				py %= rows
+			}
+
+			var bits uint16
+			for i := 0; i < bytesPerRow; i++ {
+				bits = bits<<8 | uint16(vm.memory[addr+uint16(r*bytesPerRow+i)])
+			}
+
+			line := spriteRow(bits, w, ox, cols, vm.quirks.Clip)
+			if vm.display.xor(plane, py, line) {
+				vm.registers[0xf] = 1
+			}
+		}
+
+		addr += uint16(h * bytesPerRow)
+	}
+}
+
+// Moves I past the registers stored or loaded by FX55 and FX65
+// according to the memory quirk.
+func (vm *VM) incrementIndex(vX uint16) {
+	switch vm.quirks.MemoryIncrement {
+	case IncrementX:
+		vm.ir += vX
+	case IncrementXPlus1:
+		vm.ir += vX + 1
+	}
+}
+
+// Shifts the selected planes by dx pixels to the right and dy
+// pixels down.
+func (vm *VM) scroll(dx, dy int) {
+	vm.display.scroll(vm.planes, dx, dy)
+}
+
+// Clears the selected planes.
+func (vm *VM) clearScreen() {
+	vm.display.clear(vm.planes)
+}
+
+// Returns the registers from x to y inclusive. The range runs
+// backwards if y is less than x, as used by 5XY2 and 5XY3.
+func registerRange(x, y uint16) []uint16 {
+	var r []uint16
+
+	if x <= y {
+		for i := x; i <= y; i++ {
+			r = append(r, i)
+		}
+	} else {
+		for i := x; i+1 > y; i-- {
+			r = append(r, i)
+		}
+	}
+
+	return r
+}
+
 func opcode(ins uint16) uint16 {
 	return ins & 0xF000
 }
@@ -408,8 +784,10 @@ func nnn(ins uint16) uint16 {
 	return ins & 0x0FFF
 }
 
-func logInstruction(ins uint16, msg string) {
-	if debug {
-		log.Printf("| Executing '%04x': %s\n", ins, msg)
+func btoi(b bool) uint8 {
+	if b {
+		return 1
 	}
+
+	return 0
 }
@@ -1,24 +1,19 @@
 package chip8
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
 
 var vm *VM
-var quit chan uint8
 
 func setup() {
-	vm = New(nil, false)
-}
-
-func teardown() {
-	quit <- 1
+	vm = New(WithQuirks(Quirks{IndexOverflowSetsVF: true}), WithSeed(1))
 }
 
 func TestMain(m *testing.M) {
 	setup()
-	defer teardown()
 	code := m.Run()
 	os.Exit(code)
 }
@@ -49,13 +44,13 @@ func TestFontIsLoadedToCorrectMemorySpace(t *testing.T) {
 func TestClearsDisplay(t *testing.T) {
 	var ins uint16 = 0x00E0
 
-	vm.Vram[Rows/2][Rows/2] = 1
+	vm.display.set(Rows/2, Rows/2, 1)
 
 	_ = vm.exec(ins)
 
 	for y := 0; y < Rows; y++ {
 		for x := 0; x < Cols; x++ {
-			if vm.Vram[x][y] != 0 {
+			if vm.display.Pixel(x, y) != 0 {
 				t.Fail()
 			}
 		}
@@ -387,15 +382,56 @@ func TestSetsRegXToRandomgByte(t *testing.T) {
 	}
 }
 
-func TestWaitsForKeyInput(t *testing.T) {
-	var ins uint16 = 0xf20a
-	x, _ := registersXAndYFromIns(ins)
-	vm.Keys[4] = 1
+func TestSameSeedGivesSameRandomBytes(t *testing.T) {
+	a := New(WithQuirks(QuirksVIP), WithSeed(42))
+	b := New(WithQuirks(QuirksVIP), WithSeed(42))
 
-	_ = vm.exec(ins)
+	for i := 0; i < 100; i++ {
+		_ = a.exec(0xc0ff)
+		_ = b.exec(0xc0ff)
 
-	if vm.registers[x] != 4 {
-		t.Fail()
+		if a.registers[0] != b.registers[0] {
+			t.Fatalf("diverged after %d bytes", i)
+		}
+	}
+}
+
+func TestRandomBytesCoverTheFullRange(t *testing.T) {
+	r := New(WithQuirks(QuirksVIP), WithSeed(7))
+
+	var seen [256]bool
+	for i := 0; i < 10000; i++ {
+		_ = r.exec(0xc0ff)
+		seen[r.registers[0]] = true
+	}
+
+	for v, ok := range seen {
+		if !ok {
+			t.Fatalf("never produced %02x", v)
+		}
+	}
+}
+
+func TestWaitsForKeyPressAndRelease(t *testing.T) {
+	c8 := New()
+	_ = c8.LoadRom([]byte{0xf2, 0x0a})
+
+	_ = c8.Cycle()
+	if c8.pc != 0x200 {
+		t.Fatal("did not wait for a key")
+	}
+
+	c8.Keypad.Press(4)
+	_ = c8.Cycle()
+	_ = c8.Cycle()
+	if c8.pc != 0x200 {
+		t.Fatal("did not wait for the release")
+	}
+
+	c8.Keypad.Release(4)
+	_ = c8.Cycle()
+	if c8.pc != 0x202 || c8.registers[2] != 4 {
+		t.Fatalf("got pc %03x v2 %x", c8.pc, c8.registers[2])
 	}
 }
 
@@ -519,6 +555,459 @@ func TestLoadsFromMemoryIntoRegisters(t *testing.T) {
 	}
 }
 
+func TestSwitchesToHiRes(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+
+	_ = sc.exec(0x00ff)
+
+	if w, h := sc.Resolution(); w != HiResCols || h != HiResRows {
+		t.Fail()
+	}
+
+	_ = sc.exec(0x00fe)
+
+	if w, h := sc.Resolution(); w != Cols || h != Rows {
+		t.Fail()
+	}
+}
+
+func TestIgnoresHiResOnChip8(t *testing.T) {
+	c8 := New()
+
+	_ = c8.exec(0x00ff)
+
+	if w, _ := c8.Resolution(); w != Cols {
+		t.Fail()
+	}
+}
+
+func TestScrollsDisplayDown(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.display.set(3, 0, 1)
+
+	_ = sc.exec(0x00c2)
+
+	if sc.display.Pixel(3, 0) != 0 || sc.display.Pixel(3, 2) != 1 {
+		t.Fail()
+	}
+}
+
+func TestScrollsDisplayLeftAndRight(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.display.set(10, 1, 1)
+
+	_ = sc.exec(0x00fb)
+
+	if sc.display.Pixel(10, 1) != 0 || sc.display.Pixel(14, 1) != 1 {
+		t.Fail()
+	}
+
+	_ = sc.exec(0x00fc)
+	_ = sc.exec(0x00fc)
+
+	if sc.display.Pixel(6, 1) != 1 {
+		t.Fail()
+	}
+}
+
+func TestExitStopsTheVM(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	_ = sc.LoadRom([]byte{0x00, 0xfd, 0x60, 0x01})
+
+	_ = sc.Cycle()
+	_ = sc.Cycle()
+
+	if !sc.Exited() || sc.registers[0] != 0 {
+		t.Fail()
+	}
+}
+
+func TestDraws16x16Sprite(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.ir = 0x300
+	for i := 0; i < 32; i++ {
+		sc.memory[0x300+i] = 0xff
+	}
+
+	_ = sc.exec(0xd010)
+
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			if sc.display.Pixel(x, y) != 1 {
+				t.Fail()
+			}
+		}
+	}
+	if sc.display.Pixel(16, 0) != 0 || sc.display.Pixel(0, 16) != 0 {
+		t.Fail()
+	}
+}
+
+func TestDrawSetsCarryOnlyWhenPixelsAreErased(t *testing.T) {
+	c8 := New()
+	c8.ir = 0x300
+	c8.memory[0x300] = 0x80
+
+	_ = c8.exec(0xd011)
+
+	if c8.registers[0xf] != 0 {
+		t.Fail()
+	}
+
+	_ = c8.exec(0xd011)
+
+	if c8.registers[0xf] != 1 || c8.display.Pixel(0, 0) != 0 {
+		t.Fail()
+	}
+}
+
+func TestSetsBigFontCharacter(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.registers[0] = 2
+
+	_ = sc.exec(0xf030)
+
+	if sc.ir != uint16(bigFontAddr+20) || sc.memory[sc.ir] != bigFont[20] {
+		t.Fail()
+	}
+}
+
+func TestStoresAndLoadsRPLFlags(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.registers[0] = 7
+	sc.registers[1] = 9
+
+	_ = sc.exec(0xf175)
+	sc.registers[0], sc.registers[1] = 0, 0
+	_ = sc.exec(0xf185)
+
+	if sc.registers[0] != 7 || sc.registers[1] != 9 {
+		t.Fail()
+	}
+}
+
+func TestLoadsRomsLargerThan4KOnXOChip(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+
+	if err := xo.LoadRom(make([]byte, 0x8000)); err != nil {
+		t.Fail()
+	}
+}
+
+func TestSwitchesPlatform(t *testing.T) {
+	c8 := New()
+	c8.SetPlatform(XOChip, QuirksXOChip)
+
+	if c8.Platform() != XOChip || c8.Quirks() != QuirksXOChip {
+		t.Fail()
+	}
+	rom := make([]byte, 0x8000)
+	rom[0], rom[1] = 0x60, 0x01
+	if err := c8.LoadRom(rom); err != nil {
+		t.Fatal(err)
+	}
+	if err := c8.Cycle(); err != nil || c8.registers[0] != 1 {
+		t.Fatal(err)
+	}
+}
+
+func TestPlatformPicksDefaultQuirks(t *testing.T) {
+	if New(WithPlatform(SuperChip)).Quirks() != QuirksSuperChipModern {
+		t.Fail()
+	}
+
+	if New(WithQuirks(QuirksVIP), WithPlatform(SuperChip)).Quirks() != QuirksVIP {
+		t.Fail()
+	}
+}
+
+func TestLoadsLongIndex(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	_ = xo.LoadRom([]byte{0xf0, 0x00, 0x12, 0x34})
+
+	_ = xo.Cycle()
+
+	if xo.ir != 0x1234 || xo.pc != 0x204 {
+		t.Fail()
+	}
+}
+
+func TestSkipsOverLongIndexLoad(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	_ = xo.LoadRom([]byte{0x30, 0x00, 0xf0, 0x00, 0x12, 0x34})
+
+	_ = xo.Cycle()
+
+	if xo.pc != 0x206 {
+		t.Fail()
+	}
+}
+
+func TestSavesAndLoadsRegisterRange(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	xo.ir = 0x400
+	xo.registers[2], xo.registers[3], xo.registers[4] = 1, 2, 3
+
+	_ = xo.exec(0x5242)
+
+	if xo.memory[0x400] != 1 || xo.memory[0x402] != 3 {
+		t.Fail()
+	}
+
+	_ = xo.exec(0x5423)
+
+	if xo.registers[4] != 1 || xo.registers[3] != 2 || xo.registers[2] != 3 {
+		t.Fail()
+	}
+}
+
+func TestDrawsOnSelectedPlanes(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	xo.ir = 0x400
+	xo.memory[0x400] = 0x80
+	xo.memory[0x401] = 0xc0
+
+	_ = xo.exec(0xf301)
+	_ = xo.exec(0xd011)
+
+	if xo.display.Pixel(0, 0) != 3 || xo.display.Pixel(1, 0) != 2 {
+		t.Fail()
+	}
+
+	_ = xo.exec(0xf101)
+	_ = xo.exec(0x00e0)
+
+	if xo.display.Pixel(0, 0) != 2 || xo.display.Pixel(1, 0) != 2 {
+		t.Fail()
+	}
+}
+
+func TestScrollsDisplayUp(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	xo.display.set(0, 5, 1)
+
+	_ = xo.exec(0x00d3)
+
+	if xo.display.Pixel(0, 5) != 0 || xo.display.Pixel(0, 2) != 1 {
+		t.Fail()
+	}
+}
+
+func TestLoadsAudioPatternAndPitch(t *testing.T) {
+	xo := New(WithPlatform(XOChip))
+	xo.ir = 0x400
+	xo.memory[0x40f] = 0xaa
+	xo.registers[1] = 112
+
+	_ = xo.exec(0xf002)
+	_ = xo.exec(0xf13a)
+
+	pattern, pitch := xo.AudioPattern()
+	if pattern[15] != 0xaa || pitch != 112 {
+		t.Fail()
+	}
+}
+
+func TestShiftQuirkShiftsRegY(t *testing.T) {
+	q := New(WithQuirks(Quirks{ShiftUsesVY: true}))
+	q.registers[1] = 0x81
+
+	_ = q.exec(0x801e)
+
+	if q.registers[0] != 0x02 || q.registers[0xf] != 1 {
+		t.Fail()
+	}
+}
+
+func TestMemoryQuirkIncrementsIndex(t *testing.T) {
+	for inc, expected := range map[IndexIncrement]uint16{
+		IncrementNone:   0x300,
+		IncrementX:      0x302,
+		IncrementXPlus1: 0x303,
+	} {
+		q := New(WithQuirks(Quirks{MemoryIncrement: inc}))
+		q.ir = 0x300
+
+		_ = q.exec(0xf255)
+
+		if q.ir != expected {
+			t.Errorf("increment %d: I = %03x, want %03x", inc, q.ir, expected)
+		}
+	}
+}
+
+func TestJumpQuirkUsesRegX(t *testing.T) {
+	q := New(WithPlatform(SuperChip), WithQuirks(Quirks{JumpUsesVX: true}))
+	q.registers[0] = 1
+	q.registers[2] = 4
+
+	_ = q.exec(0xb220)
+
+	if q.pc != 0x224 {
+		t.Fail()
+	}
+}
+
+func TestClipQuirkClipsSprites(t *testing.T) {
+	q := New(WithQuirks(Quirks{Clip: true}))
+	q.ir = 0x300
+	q.memory[0x300] = 0xff
+	q.registers[0] = Cols - 4
+
+	_ = q.exec(0xd011)
+
+	if q.display.Pixel(Cols-1, 0) != 1 || q.display.Pixel(0, 0) != 0 {
+		t.Fail()
+	}
+
+	// The origin still wraps around.
+	q.registers[0] = Cols
+
+	_ = q.exec(0xd011)
+
+	if q.display.Pixel(0, 0) != 1 {
+		t.Fail()
+	}
+}
+
+func TestLogicQuirkResetsVF(t *testing.T) {
+	q := New(WithQuirks(Quirks{LogicResetsVF: true}))
+	q.registers[0xf] = 1
+
+	_ = q.exec(0x8011)
+
+	if q.registers[0xf] != 0 {
+		t.Fail()
+	}
+}
+
+func TestIndexOverflowLeavesVFWithoutQuirk(t *testing.T) {
+	q := New(WithQuirks(Quirks{}))
+	q.ir = 0xfff
+	q.registers[0] = 1
+
+	_ = q.exec(0xf01e)
+
+	if q.registers[0xf] != 0 {
+		t.Fail()
+	}
+}
+
+func TestParsesQuirksPresets(t *testing.T) {
+	q, err := ParseQuirks("vip")
+	if err != nil || q != QuirksVIP {
+		t.Fail()
+	}
+
+	if _, err := ParseQuirks("nope"); err == nil {
+		t.Fail()
+	}
+}
+
+func TestCycleLeavesTimersAlone(t *testing.T) {
+	c8 := New()
+	_ = c8.LoadRom([]byte{0x60, 0x01, 0x60, 0x02})
+	c8.dt = 5
+
+	_ = c8.Cycle()
+	_ = c8.Cycle()
+
+	if c8.dt != 5 {
+		t.Fail()
+	}
+}
+
+func TestRunFrameTicksTimersOnce(t *testing.T) {
+	c8 := New()
+	_ = c8.LoadRom([]byte{0x12, 0x00})
+	c8.dt = 5
+	c8.st = 5
+
+	_ = c8.RunFrame(100)
+
+	if c8.dt != 4 || c8.st != 4 {
+		t.Fail()
+	}
+}
+
+func TestReturnWithEmptyStackFaults(t *testing.T) {
+	c8 := New(WithQuirks(QuirksVIP))
+	_ = c8.LoadRom([]byte{0x00, 0xee})
+
+	err := c8.Cycle()
+
+	var f *Fault
+	if !errors.Is(err, ErrStackUnderflow) || !errors.As(err, &f) || f.PC != 0x200 || f.Opcode != 0x00ee {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestSixteenNestedCallsFitOnTheStack(t *testing.T) {
+	c8 := New(WithQuirks(QuirksVIP))
+	// Calls itself forever.
+	_ = c8.LoadRom([]byte{0x22, 0x00})
+
+	for i := 0; i < 16; i++ {
+		if err := c8.Cycle(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+
+	if err := c8.Cycle(); !errors.Is(err, ErrStackOverflow) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestFetchingPastMemoryFaults(t *testing.T) {
+	c8 := New(WithQuirks(QuirksVIP))
+	c8.pc = 0xfff
+
+	if err := c8.Cycle(); !errors.Is(err, ErrMemoryBounds) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestAccessingMemoryPastIFaults(t *testing.T) {
+	for _, ins := range []uint16{0xd005, 0xf033, 0xff55, 0xff65} {
+		c8 := New(WithQuirks(QuirksVIP))
+		c8.ir = 0xffe
+
+		if err := c8.exec(ins); !errors.Is(err, ErrMemoryBounds) {
+			t.Errorf("%04x: got %v", ins, err)
+		}
+	}
+}
+
+func TestUnknownOpcodesFault(t *testing.T) {
+	for _, ins := range []uint16{0x0123, 0x00ff, 0x5121, 0x8008, 0x9121, 0xe000, 0xf0ff, 0xf075} {
+		c8 := New(WithQuirks(QuirksVIP))
+
+		if err := c8.exec(ins); !errors.Is(err, ErrUnknownOpcode) {
+			t.Errorf("%04x: got %v", ins, err)
+		}
+	}
+}
+
+func TestReadsRegistersAndMemory(t *testing.T) {
+	c8 := New(WithQuirks(QuirksVIP))
+	_ = c8.LoadRom([]byte{0x6a, 0x02, 0x22, 0x00})
+	_ = c8.Cycle()
+	_ = c8.Cycle()
+
+	r := c8.Registers()
+	if r.V[0xa] != 2 || r.PC != 0x200 || r.SP != 1 || r.Stack[0] != 0x202 {
+		t.Fatalf("got %+v", r)
+	}
+
+	if m := c8.ReadMemory(0x200, 2); len(m) != 2 || m[0] != 0x6a {
+		t.Fatalf("got %v", m)
+	}
+
+	if m := c8.ReadMemory(0xffe, 16); len(m) != 2 {
+		t.Fatalf("read %d bytes past the end of memory", len(m)-2)
+	}
+}
+
 func registersXAndYFromIns(ins uint16) (uint16, uint16) {
 	return ((ins & 0x0f00) >> 8), ((ins & 0x00f0) >> 4)
 }
@@ -0,0 +1,546 @@
+package chip8
+
+// Executes a pre-decoded instruction.
+type handler func(vm *VM, d *decoded) error
+
+// An instruction split into its operands, along with the handler
+// that runs it. The handler is nil until the address is decoded,
+// and set back to nil whenever the memory under it is written.
+type decoded struct {
+	handler handler
+	ins     uint16
+	nnn     uint16
+	x, y    uint8
+	n, nn   uint8
+}
+
+// Executes the instruction at the program counter, decoding it
+// the first time it is seen. The cache holds one entry per
+// address so jumps into the middle of an instruction still work.
+func (vm *VM) execDecoded() error {
+	d := &vm.cache[vm.pc]
+	if d.handler == nil {
+		vm.decode(d, vm.fetchInstruction())
+	}
+
+	return d.handler(vm, d)
+}
+
+// Drops the decoded instructions overlapping the n bytes written
+// at addr. That includes the one starting the byte before, whose
+// second half was written.
+func (vm *VM) invalidate(addr uint16, n int) {
+	start, end := int(addr)-1, int(addr)+n
+	if start < 0 {
+		start = 0
+	}
+	if end > len(vm.cache) {
+		end = len(vm.cache)
+	}
+
+	for i := start; i < end; i++ {
+		vm.cache[i].handler = nil
+	}
+}
+
+// Drops every decoded instruction, resizing the cache to the
+// platform's memory.
+func (vm *VM) invalidateAll() {
+	if len(vm.cache) != vm.platform.MemorySize() {
+		vm.cache = make([]decoded, vm.platform.MemorySize())
+		return
+	}
+
+	clear(vm.cache)
+}
+
+// Picks the handler for ins. The quirks only change along with
+// the whole cache, so they are resolved here rather than on every
+// execution. Anything without a fast path goes through exec.
+func (vm *VM) decode(d *decoded, ins uint16) {
+	*d = decoded{
+		handler: execSwitch,
+		ins:     ins,
+		nnn:     nnn(ins),
+		x:       uint8(registerX(ins)),
+		y:       uint8(registerY(ins)),
+		n:       uint8(n(ins)),
+		nn:      uint8(nn(ins)),
+	}
+
+	schip := vm.platform >= SuperChip
+	xo := vm.platform >= XOChip
+
+	switch opcode(ins) {
+	case 0x0000:
+		switch ins {
+		case 0x00e0:
+			d.handler = execClear
+		case 0x00ee:
+			d.handler = execReturn
+		}
+	case 0x1000:
+		d.handler = execJump
+	case 0x2000:
+		d.handler = execCall
+	case 0x3000:
+		d.handler = execSkipEqImm
+	case 0x4000:
+		d.handler = execSkipNeImm
+	case 0x5000:
+		if n(ins) == 0 {
+			d.handler = execSkipEq
+		}
+	case 0x6000:
+		d.handler = execLoadImm
+	case 0x7000:
+		d.handler = execAddImm
+	case 0x8000:
+		switch n(ins) {
+		case 0x0:
+			d.handler = execLoad
+		case 0x1:
+			d.handler = pick(vm.quirks.LogicResetsVF, execOrResetVF, execOr)
+		case 0x2:
+			d.handler = pick(vm.quirks.LogicResetsVF, execAndResetVF, execAnd)
+		case 0x3:
+			d.handler = pick(vm.quirks.LogicResetsVF, execXorResetVF, execXor)
+		case 0x4:
+			d.handler = execAdd
+		case 0x5:
+			d.handler = execSub
+		case 0x6:
+			d.handler = pick(vm.quirks.ShiftUsesVY, execShrVY, execShr)
+		case 0x7:
+			d.handler = execSubn
+		case 0xe:
+			d.handler = pick(vm.quirks.ShiftUsesVY, execShlVY, execShl)
+		}
+	case 0x9000:
+		if n(ins) == 0 {
+			d.handler = execSkipNe
+		}
+	case 0xa000:
+		d.handler = execLoadIndex
+	case 0xb000:
+		d.handler = pick(vm.quirks.JumpUsesVX, execJumpVX, execJumpV0)
+	case 0xc000:
+		d.handler = execRand
+	case 0xd000:
+		d.handler = pick(d.n == 0 && schip, execDrawBig, execDraw)
+	case 0xe000:
+		switch d.nn {
+		case 0x9e:
+			d.handler = execSkipKey
+		case 0xa1:
+			d.handler = execSkipNotKey
+		}
+	case 0xf000:
+		switch {
+		case ins == 0xf000:
+			// The operand is the next word, which can change
+			// without this one being written.
+		case xo && d.nn == 0x01:
+			d.handler = execPlanes
+		case xo && ins == 0xf002:
+			d.handler = execLoadPattern
+		case xo && d.nn == 0x3a:
+			d.handler = execPitch
+		case d.nn == 0x07:
+			d.handler = execLoadDelay
+		case d.nn == 0x0a:
+			d.handler = execWaitKey
+		case d.nn == 0x15:
+			d.handler = execSetDelay
+		case d.nn == 0x18:
+			d.handler = execSetSound
+		case d.nn == 0x1e:
+			d.handler = pick(vm.quirks.IndexOverflowSetsVF, execAddIndexVF, execAddIndex)
+		case d.nn == 0x29:
+			d.handler = execFont
+		case schip && d.nn == 0x30:
+			d.handler = execBigFont
+		case d.nn == 0x33:
+			d.handler = execBCD
+		case d.nn == 0x55:
+			d.handler = execSave
+		case d.nn == 0x65:
+			d.handler = execRestore
+		case schip && d.nn == 0x75:
+			d.handler = execSaveFlags
+		case schip && d.nn == 0x85:
+			d.handler = execLoadFlags
+		}
+	}
+}
+
+// Returns a if the quirk is set and b otherwise.
+func pick(quirk bool, a, b handler) handler {
+	if quirk {
+		return a
+	}
+
+	return b
+}
+
+// Falls back to the interpreter switch.
+func execSwitch(vm *VM, d *decoded) error {
+	return vm.exec(d.ins)
+}
+
+func execClear(vm *VM, d *decoded) error {
+	vm.clearScreen()
+	vm.pc += 2
+	return nil
+}
+
+func execReturn(vm *VM, d *decoded) error {
+	if vm.sp == 0 {
+		return vm.fault(ErrStackUnderflow, d.ins)
+	}
+	vm.sp--
+	vm.pc = vm.stack[vm.sp] + 2
+	return nil
+}
+
+func execJump(vm *VM, d *decoded) error {
+	vm.pc = d.nnn
+	return nil
+}
+
+func execCall(vm *VM, d *decoded) error {
+	if int(vm.sp) == len(vm.stack) {
+		return vm.fault(ErrStackOverflow, d.ins)
+	}
+	vm.stack[vm.sp] = vm.pc
+	vm.sp++
+	vm.pc = d.nnn
+	return nil
+}
+
+// Moves past the next instruction if skip is set.
+func (vm *VM) skipIf(skip bool) {
+	if skip {
+		vm.pc += vm.skipLength()
+	} else {
+		vm.pc += 2
+	}
+}
+
+func execSkipEqImm(vm *VM, d *decoded) error {
+	vm.skipIf(vm.registers[d.x] == d.nn)
+	return nil
+}
+
+func execSkipNeImm(vm *VM, d *decoded) error {
+	vm.skipIf(vm.registers[d.x] != d.nn)
+	return nil
+}
+
+func execSkipEq(vm *VM, d *decoded) error {
+	vm.skipIf(vm.registers[d.x] == vm.registers[d.y])
+	return nil
+}
+
+func execSkipNe(vm *VM, d *decoded) error {
+	vm.skipIf(vm.registers[d.x] != vm.registers[d.y])
+	return nil
+}
+
+func execLoadImm(vm *VM, d *decoded) error {
+	vm.registers[d.x] = d.nn
+	vm.pc += 2
+	return nil
+}
+
+func execAddImm(vm *VM, d *decoded) error {
+	vm.registers[d.x] += d.nn
+	vm.pc += 2
+	return nil
+}
+
+func execLoad(vm *VM, d *decoded) error {
+	vm.registers[d.x] = vm.registers[d.y]
+	vm.pc += 2
+	return nil
+}
+
+func execOr(vm *VM, d *decoded) error {
+	vm.registers[d.x] |= vm.registers[d.y]
+	vm.pc += 2
+	return nil
+}
+
+func execAnd(vm *VM, d *decoded) error {
+	vm.registers[d.x] &= vm.registers[d.y]
+	vm.pc += 2
+	return nil
+}
+
+func execXor(vm *VM, d *decoded) error {
+	vm.registers[d.x] ^= vm.registers[d.y]
+	vm.pc += 2
+	return nil
+}
+
+func execOrResetVF(vm *VM, d *decoded) error {
+	vm.registers[d.x] |= vm.registers[d.y]
+	vm.registers[0xf] = 0
+	vm.pc += 2
+	return nil
+}
+
+func execAndResetVF(vm *VM, d *decoded) error {
+	vm.registers[d.x] &= vm.registers[d.y]
+	vm.registers[0xf] = 0
+	vm.pc += 2
+	return nil
+}
+
+func execXorResetVF(vm *VM, d *decoded) error {
+	vm.registers[d.x] ^= vm.registers[d.y]
+	vm.registers[0xf] = 0
+	vm.pc += 2
+	return nil
+}
+
+func execAdd(vm *VM, d *decoded) error {
+	r := uint16(vm.registers[d.x]) + uint16(vm.registers[d.y])
+	vm.registers[d.x] = uint8(r)
+	vm.registers[0xf] = uint8(r >> 8)
+	vm.pc += 2
+	return nil
+}
+
+func execSub(vm *VM, d *decoded) error {
+	x, y := vm.registers[d.x], vm.registers[d.y]
+	vm.registers[d.x] = x - y
+	vm.registers[0xf] = btoi(x >= y)
+	vm.pc += 2
+	return nil
+}
+
+func execShr(vm *VM, d *decoded) error {
+	flag := vm.registers[d.x] & 1
+	vm.registers[d.x] >>= 1
+	vm.registers[0xf] = flag
+	vm.pc += 2
+	return nil
+}
+
+func execShrVY(vm *VM, d *decoded) error {
+	vm.registers[d.x] = vm.registers[d.y]
+	return execShr(vm, d)
+}
+
+func execSubn(vm *VM, d *decoded) error {
+	x, y := vm.registers[d.x], vm.registers[d.y]
+	vm.registers[d.x] = y - x
+	vm.registers[0xf] = btoi(y >= x)
+	vm.pc += 2
+	return nil
+}
+
+func execShl(vm *VM, d *decoded) error {
+	flag := vm.registers[d.x] >> 7
+	vm.registers[d.x] <<= 1
+	vm.registers[0xf] = flag
+	vm.pc += 2
+	return nil
+}
+
+func execShlVY(vm *VM, d *decoded) error {
+	vm.registers[d.x] = vm.registers[d.y]
+	return execShl(vm, d)
+}
+
+func execLoadIndex(vm *VM, d *decoded) error {
+	vm.ir = d.nnn
+	vm.pc += 2
+	return nil
+}
+
+func execJumpV0(vm *VM, d *decoded) error {
+	vm.pc = uint16(vm.registers[0]) + d.nnn
+	return nil
+}
+
+func execJumpVX(vm *VM, d *decoded) error {
+	vm.pc = uint16(vm.registers[d.x]) + d.nnn
+	return nil
+}
+
+func execRand(vm *VM, d *decoded) error {
+	vm.registers[d.x] = vm.rand.byte() & d.nn
+	vm.pc += 2
+	return nil
+}
+
+func execDraw(vm *VM, d *decoded) error {
+	return vm.drawDecoded(d, 8, int(d.n))
+}
+
+func execDrawBig(vm *VM, d *decoded) error {
+	return vm.drawDecoded(d, 16, 16)
+}
+
+func (vm *VM) drawDecoded(d *decoded, w, h int) error {
+	size := vm.spriteSize(w, h)
+	if !vm.inBounds(vm.ir, size) {
+		return vm.fault(ErrMemoryBounds, d.ins)
+	}
+
+	vm.watch(vm.ir, size, false)
+	vm.draw(vm.registers[d.x], vm.registers[d.y], w, h)
+	vm.pc += 2
+	return nil
+}
+
+func execSkipKey(vm *VM, d *decoded) error {
+	vm.skipIf(vm.Keypad.IsPressed(Key(vm.registers[d.x])))
+	return nil
+}
+
+func execSkipNotKey(vm *VM, d *decoded) error {
+	vm.skipIf(!vm.Keypad.IsPressed(Key(vm.registers[d.x])))
+	return nil
+}
+
+func execLoadDelay(vm *VM, d *decoded) error {
+	vm.registers[d.x] = vm.dt
+	vm.pc += 2
+	return nil
+}
+
+func execSetDelay(vm *VM, d *decoded) error {
+	vm.dt = vm.registers[d.x]
+	vm.pc += 2
+	return nil
+}
+
+func execAddIndex(vm *VM, d *decoded) error {
+	vm.ir += uint16(vm.registers[d.x])
+	vm.pc += 2
+	return nil
+}
+
+func execFont(vm *VM, d *decoded) error {
+	vm.ir = uint16(vm.registers[d.x]&0xf) * 5
+	vm.pc += 2
+	return nil
+}
+
+func execPlanes(vm *VM, d *decoded) error {
+	vm.planes = d.x & 0x3
+	vm.pc += 2
+	return nil
+}
+
+func execLoadPattern(vm *VM, d *decoded) error {
+	if !vm.inBounds(vm.ir, len(vm.pattern)) {
+		return vm.fault(ErrMemoryBounds, d.ins)
+	}
+	copy(vm.pattern[:], vm.memory[vm.ir:])
+	vm.watch(vm.ir, len(vm.pattern), false)
+	vm.updatePattern()
+	vm.pc += 2
+	return nil
+}
+
+func execPitch(vm *VM, d *decoded) error {
+	vm.pitch = vm.registers[d.x]
+	vm.updatePattern()
+	vm.pc += 2
+	return nil
+}
+
+// Repeats until a key is pressed and released, see exec.
+func execWaitKey(vm *VM, d *decoded) error {
+	switch {
+	case vm.waitKey == noKey:
+		for k := Key(0); k < 16; k++ {
+			if vm.Keypad.IsPressed(k) {
+				vm.waitKey = int8(k)
+				break
+			}
+		}
+	case !vm.Keypad.IsPressed(Key(vm.waitKey)):
+		vm.registers[d.x] = uint8(vm.waitKey)
+		vm.waitKey = noKey
+		vm.pc += 2
+	}
+	return nil
+}
+
+func execSetSound(vm *VM, d *decoded) error {
+	vm.st = vm.registers[d.x]
+	vm.updateSound()
+	vm.pc += 2
+	return nil
+}
+
+func execAddIndexVF(vm *VM, d *decoded) error {
+	vm.ir += uint16(vm.registers[d.x])
+	if vm.ir > 0xfff {
+		vm.registers[0xf] = 1
+	}
+	vm.pc += 2
+	return nil
+}
+
+func execBigFont(vm *VM, d *decoded) error {
+	vm.ir = uint16(bigFontAddr) + uint16(vm.registers[d.x]&0xf)*10
+	vm.pc += 2
+	return nil
+}
+
+func execBCD(vm *VM, d *decoded) error {
+	if !vm.inBounds(vm.ir, 3) {
+		return vm.fault(ErrMemoryBounds, d.ins)
+	}
+	v := vm.registers[d.x]
+	vm.memory[vm.ir] = v / 100
+	vm.memory[vm.ir+1] = v / 10 % 10
+	vm.memory[vm.ir+2] = v % 10
+	vm.invalidate(vm.ir, 3)
+	vm.watch(vm.ir, 3, true)
+	vm.pc += 2
+	return nil
+}
+
+func execSave(vm *VM, d *decoded) error {
+	n := int(d.x) + 1
+	if !vm.inBounds(vm.ir, n) {
+		return vm.fault(ErrMemoryBounds, d.ins)
+	}
+	copy(vm.memory[vm.ir:], vm.registers[:n])
+	vm.invalidate(vm.ir, n)
+	vm.watch(vm.ir, n, true)
+	vm.incrementIndex(uint16(d.x))
+	vm.pc += 2
+	return nil
+}
+
+func execRestore(vm *VM, d *decoded) error {
+	n := int(d.x) + 1
+	if !vm.inBounds(vm.ir, n) {
+		return vm.fault(ErrMemoryBounds, d.ins)
+	}
+	copy(vm.registers[:n], vm.memory[vm.ir:])
+	vm.watch(vm.ir, n, false)
+	vm.incrementIndex(uint16(d.x))
+	vm.pc += 2
+	return nil
+}
+
+func execSaveFlags(vm *VM, d *decoded) error {
+	copy(vm.rpl[:d.x+1], vm.registers[:d.x+1])
+	vm.pc += 2
+	return nil
+}
+
+func execLoadFlags(vm *VM, d *decoded) error {
+	copy(vm.registers[:d.x+1], vm.rpl[:d.x+1])
+	vm.pc += 2
+	return nil
+}
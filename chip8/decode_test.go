@@ -0,0 +1,207 @@
+package chip8
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Counts up in v0 and v1 forever, without drawing.
+var loopRom = []byte{
+	0x60, 0x00, // v0 := 0
+	0x61, 0x00, // v1 := 0
+	0x70, 0x01, // v0 += 1
+	0x81, 0x04, // v1 += v0
+	0x82, 0x06, // v2 >>= v0
+	0x30, 0x00, // if v0 != 0 then
+	0x12, 0x04, // jump 0x204
+	0x12, 0x00, // jump 0x200
+}
+
+// Draws hex digits across the screen forever, converting to BCD
+// and saving and loading registers on the way, as games do between
+// frames. v0 stays 0 for the jump.
+var drawRom = []byte{
+	0x60, 0x00, // v0 := 0
+	0x61, 0x00, // v1 := 0
+	0x62, 0x00, // v2 := 0
+	0x63, 0x01, // v3 := 1
+	0x65, 0x00, // v5 := 0
+	0xf2, 0x29, // 0x20a: i := hex v2
+	0xd5, 0x15, // sprite v5 v1 5
+	0x75, 0x05, // v5 += 5
+	0x71, 0x03, // v1 += 3
+	0x72, 0x01, // v2 += 1
+	0xa3, 0x00, // i := 0x300
+	0xf2, 0x33, // bcd v2
+	0xf3, 0x1e, // i += v3
+	0xf2, 0x55, // save v2
+	0xa3, 0x00, // i := 0x300
+	0xf2, 0x65, // load v2
+	0xf2, 0x18, // buzzer := v2
+	0xb2, 0x0a, // jump0 0x20a
+}
+
+func TestDecodedMatchesSwitch(t *testing.T) {
+	roms := map[string][]byte{"draw": drawRom}
+	paths, _ := filepath.Glob("../static/roms/*.ch8")
+	for _, path := range paths {
+		rom, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roms[path] = rom
+	}
+
+	for path, rom := range roms {
+
+		for _, pq := range []struct {
+			p Platform
+			q Quirks
+		}{
+			{Chip8, QuirksVIP},
+			{SuperChip, QuirksSuperChipModern},
+			{XOChip, QuirksXOChip},
+		} {
+			decoded := New(WithPlatform(pq.p), WithQuirks(pq.q), WithSeed(7))
+			switched := New(WithPlatform(pq.p), WithQuirks(pq.q), WithSeed(7))
+			_ = decoded.LoadRom(rom)
+			_ = switched.LoadRom(rom)
+
+			for i := 0; i < 20000; i++ {
+				errD := decoded.execDecoded()
+				errS := switched.exec(switched.fetchInstruction())
+
+				if decoded.Registers() != switched.Registers() || decoded.display != switched.display ||
+					decoded.memory != switched.memory {
+					t.Fatalf("%s: diverged at %03x after %d instructions", path, switched.pc, i)
+				}
+				if errD != nil || errS != nil {
+					if errD == nil || errS == nil || errD.Error() != errS.Error() {
+						t.Fatalf("%s: got %v, want %v", path, errD, errS)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSelfModifyingCodeIsRedecoded(t *testing.T) {
+	vm := New()
+	_ = vm.LoadRom([]byte{
+		0x60, 0x72, // v0 := 0x72
+		0x61, 0x10, // v1 := 0x10
+		0xa2, 0x0a, // i := 0x20a
+		0x22, 0x0a, // call 0x20a
+		0x12, 0x0e, // jump 0x20e
+		0x72, 0x01, // 0x20a: v2 += 0x01
+		0x00, 0xee, // return
+		0xf1, 0x55, // 0x20e: save v1, rewriting 0x20a to v2 += 0x10
+		0x22, 0x0a, // call 0x20a
+		0x12, 0x12, // jump 0x212
+	})
+
+	for i := 0; i < 12; i++ {
+		if err := vm.Cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if vm.registers[2] != 0x11 {
+		t.Fatalf("got v2 = %02x", vm.registers[2])
+	}
+}
+
+func TestInvalidatesInstructionStartingTheByteBefore(t *testing.T) {
+	vm := New()
+	_ = vm.LoadRom([]byte{0x60, 0x01})
+
+	_ = vm.execDecoded()
+	vm.invalidate(0x201, 1)
+
+	if vm.cache[0x200].handler != nil {
+		t.Fail()
+	}
+}
+
+func TestLoadStateDropsDecodedInstructions(t *testing.T) {
+	vm := New()
+	_ = vm.LoadRom([]byte{0x60, 0x01, 0x12, 0x00})
+
+	var state bytes.Buffer
+	_ = vm.SaveState(&state)
+
+	_ = vm.LoadRom([]byte{0x60, 0x02, 0x12, 0x00})
+	_ = vm.execDecoded()
+
+	if err := vm.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	_ = vm.execDecoded()
+
+	if vm.registers[0] != 1 {
+		t.Fatalf("got v0 = %d", vm.registers[0])
+	}
+}
+
+// Benchmarks exec on the loops above and on pong, which plays
+// itself. The other bundled ROMs sit in FX0A until a key is hit.
+func benchmarkRoms(b *testing.B, exec func(vm *VM) error) {
+	pong, err := os.ReadFile("../static/roms/pong.ch8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	names, roms := []string{"loop", "draw", "pong"}, [][]byte{loopRom, drawRom, pong}
+
+	for i, rom := range roms {
+		b.Run(names[i], func(b *testing.B) {
+			vm := New(WithSeed(1))
+			_ = vm.LoadRom(rom)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := exec(vm); err != nil {
+					b.StopTimer()
+					_ = vm.LoadRom(rom)
+					b.StartTimer()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSwitch(b *testing.B) {
+	benchmarkRoms(b, func(vm *VM) error {
+		return vm.exec(vm.fetchInstruction())
+	})
+}
+
+func BenchmarkDecoded(b *testing.B) {
+	benchmarkRoms(b, func(vm *VM) error {
+		return vm.execDecoded()
+	})
+}
+
+// Benchmarks whole cycles, with the cache and without it.
+func BenchmarkCycle(b *testing.B) {
+	benchmarkRoms(b, (*VM).Cycle)
+}
+
+func BenchmarkCycleSwitch(b *testing.B) {
+	benchmarkRoms(b, func(vm *VM) error {
+		// Cycle with the switch in place of the cache.
+		if vm.exited {
+			return nil
+		}
+		vm.resuming = false
+		vm.watchHit = nil
+		if !vm.inBounds(vm.pc, 2) {
+			return vm.fault(ErrMemoryBounds, 0)
+		}
+		vm.Keypad.update()
+
+		return vm.exec(vm.fetchInstruction())
+	})
+}
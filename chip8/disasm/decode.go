@@ -0,0 +1,322 @@
+// Package disasm decodes CHIP-8, SUPER-CHIP and XO-CHIP machine
+// code into structured instructions and prints them in the syntax
+// of Octo, the de facto CHIP-8 assembler.
+package disasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Identifies what an instruction does.
+type Op uint8
+
+const (
+	OpInvalid Op = iota
+
+	OpClear       // 00E0
+	OpReturn      // 00EE
+	OpScrollDown  // 00CN
+	OpScrollUp    // 00DN
+	OpScrollRight // 00FB
+	OpScrollLeft  // 00FC
+	OpExit        // 00FD
+	OpLores       // 00FE
+	OpHires       // 00FF
+	OpJump        // 1NNN
+	OpCall        // 2NNN
+	OpSkipEqImm   // 3XNN
+	OpSkipNeImm   // 4XNN
+	OpSkipEqReg   // 5XY0
+	OpSaveRange   // 5XY2
+	OpLoadRange   // 5XY3
+	OpSetImm      // 6XNN
+	OpAddImm      // 7XNN
+	OpSetReg      // 8XY0
+	OpOr          // 8XY1
+	OpAnd         // 8XY2
+	OpXor         // 8XY3
+	OpAdd         // 8XY4
+	OpSub         // 8XY5
+	OpShr         // 8XY6
+	OpSubn        // 8XY7
+	OpShl         // 8XYE
+	OpSkipNeReg   // 9XY0
+	OpSetI        // ANNN
+	OpJump0       // BNNN
+	OpRandom      // CXNN
+	OpSprite      // DXYN
+	OpSkipKey     // EX9E
+	OpSkipNotKey  // EXA1
+	OpLongI       // F000 NNNN
+	OpPlane       // FN01
+	OpAudio       // F002
+	OpGetDelay    // FX07
+	OpWaitKey     // FX0A
+	OpSetDelay    // FX15
+	OpSetBuzzer   // FX18
+	OpAddI        // FX1E
+	OpHex         // FX29
+	OpBigHex      // FX30
+	OpBCD         // FX33
+	OpPitch       // FX3A
+	OpSave        // FX55
+	OpLoad        // FX65
+	OpSaveFlags   // FX75
+	OpLoadFlags   // FX85
+)
+
+// The classic assembly mnemonic for each op.
+var mnemonics = [...]string{
+	OpInvalid:     "DW",
+	OpClear:       "CLS",
+	OpReturn:      "RET",
+	OpScrollDown:  "SCD",
+	OpScrollUp:    "SCU",
+	OpScrollRight: "SCR",
+	OpScrollLeft:  "SCL",
+	OpExit:        "EXIT",
+	OpLores:       "LOW",
+	OpHires:       "HIGH",
+	OpJump:        "JP",
+	OpCall:        "CALL",
+	OpSkipEqImm:   "SE",
+	OpSkipNeImm:   "SNE",
+	OpSkipEqReg:   "SE",
+	OpSaveRange:   "SAVE",
+	OpLoadRange:   "LOAD",
+	OpSetImm:      "LD",
+	OpAddImm:      "ADD",
+	OpSetReg:      "LD",
+	OpOr:          "OR",
+	OpAnd:         "AND",
+	OpXor:         "XOR",
+	OpAdd:         "ADD",
+	OpSub:         "SUB",
+	OpShr:         "SHR",
+	OpSubn:        "SUBN",
+	OpShl:         "SHL",
+	OpSkipNeReg:   "SNE",
+	OpSetI:        "LD",
+	OpJump0:       "JP",
+	OpRandom:      "RND",
+	OpSprite:      "DRW",
+	OpSkipKey:     "SKP",
+	OpSkipNotKey:  "SKNP",
+	OpLongI:       "LD",
+	OpPlane:       "PLANE",
+	OpAudio:       "AUDIO",
+	OpGetDelay:    "LD",
+	OpWaitKey:     "LD",
+	OpSetDelay:    "LD",
+	OpSetBuzzer:   "LD",
+	OpAddI:        "ADD",
+	OpHex:         "LD",
+	OpBigHex:      "LD",
+	OpBCD:         "LD",
+	OpPitch:       "PITCH",
+	OpSave:        "LD",
+	OpLoad:        "LD",
+	OpSaveFlags:   "LD",
+	OpLoadFlags:   "LD",
+}
+
+func (op Op) String() string {
+	if int(op) < len(mnemonics) {
+		return mnemonics[op]
+	}
+
+	return fmt.Sprintf("Op(%d)", uint8(op))
+}
+
+// What an operand refers to.
+type OperandKind uint8
+
+const (
+	// One of v0-vF.
+	Register OperandKind = iota
+
+	// An 8 bit immediate.
+	Byte
+
+	// A 4 bit immediate, such as a sprite height or plane mask.
+	Nibble
+
+	// A 12 or 16 bit memory address.
+	Address
+)
+
+type Operand struct {
+	Kind  OperandKind
+	Value uint16
+}
+
+// A decoded instruction.
+type Instruction struct {
+	Op Op
+
+	// The first 16 bits of the instruction.
+	Opcode uint16
+
+	// The operands in the order they appear in the opcode. For
+	// example 8XY4 gives vX then vY.
+	Operands []Operand
+
+	// The size of the instruction in bytes: 2, or 4 for F000 NNNN.
+	Len int
+}
+
+// The 8XYN ops by N.
+var aluOps = map[uint16]Op{
+	0x0: OpSetReg, 0x1: OpOr, 0x2: OpAnd, 0x3: OpXor, 0x4: OpAdd,
+	0x5: OpSub, 0x6: OpShr, 0x7: OpSubn, 0xe: OpShl,
+}
+
+// The FXNN ops by NN, apart from FN01 and F002 which take no
+// register.
+var fxOps = map[uint16]Op{
+	0x07: OpGetDelay, 0x0a: OpWaitKey, 0x15: OpSetDelay, 0x18: OpSetBuzzer,
+	0x1e: OpAddI, 0x29: OpHex, 0x30: OpBigHex, 0x33: OpBCD, 0x3a: OpPitch,
+	0x55: OpSave, 0x65: OpLoad, 0x75: OpSaveFlags, 0x85: OpLoadFlags,
+}
+
+var ErrShortInput = errors.New("Not enough bytes to decode an instruction.")
+
+// Returns the classic assembly mnemonic, such as LD or DRW.
+func (ins Instruction) Mnemonic() string {
+	return ins.Op.String()
+}
+
+// Decodes the instruction at the start of b. Anything that is
+// not a valid opcode decodes to OpInvalid with a length of 2, so
+// it can be emitted as data.
+func Decode(b []byte) (Instruction, error) {
+	if len(b) < 2 {
+		return Instruction{}, ErrShortInput
+	}
+
+	op := uint16(b[0])<<8 | uint16(b[1])
+	ins := Instruction{Opcode: op, Len: 2}
+
+	x := Operand{Register, (op >> 8) & 0xf}
+	y := Operand{Register, (op >> 4) & 0xf}
+	n := Operand{Nibble, op & 0xf}
+	nn := Operand{Byte, op & 0xff}
+	nnn := Operand{Address, op & 0xfff}
+
+	set := func(o Op, operands ...Operand) {
+		ins.Op = o
+		ins.Operands = operands
+	}
+
+	switch op & 0xf000 {
+	case 0x0000:
+		switch {
+		case op == 0x00e0:
+			set(OpClear)
+		case op == 0x00ee:
+			set(OpReturn)
+		case op&0xfff0 == 0x00c0:
+			set(OpScrollDown, n)
+		case op&0xfff0 == 0x00d0:
+			set(OpScrollUp, n)
+		case op == 0x00fb:
+			set(OpScrollRight)
+		case op == 0x00fc:
+			set(OpScrollLeft)
+		case op == 0x00fd:
+			set(OpExit)
+		case op == 0x00fe:
+			set(OpLores)
+		case op == 0x00ff:
+			set(OpHires)
+		}
+	case 0x1000:
+		set(OpJump, nnn)
+	case 0x2000:
+		set(OpCall, nnn)
+	case 0x3000:
+		set(OpSkipEqImm, x, nn)
+	case 0x4000:
+		set(OpSkipNeImm, x, nn)
+	case 0x5000:
+		switch n.Value {
+		case 0x0:
+			set(OpSkipEqReg, x, y)
+		case 0x2:
+			set(OpSaveRange, x, y)
+		case 0x3:
+			set(OpLoadRange, x, y)
+		}
+	case 0x6000:
+		set(OpSetImm, x, nn)
+	case 0x7000:
+		set(OpAddImm, x, nn)
+	case 0x8000:
+		if o, ok := aluOps[n.Value]; ok {
+			set(o, x, y)
+		}
+	case 0x9000:
+		if n.Value == 0 {
+			set(OpSkipNeReg, x, y)
+		}
+	case 0xa000:
+		set(OpSetI, nnn)
+	case 0xb000:
+		set(OpJump0, nnn)
+	case 0xc000:
+		set(OpRandom, x, nn)
+	case 0xd000:
+		set(OpSprite, x, y, n)
+	case 0xe000:
+		switch nn.Value {
+		case 0x9e:
+			set(OpSkipKey, x)
+		case 0xa1:
+			set(OpSkipNotKey, x)
+		}
+	case 0xf000:
+		if op == 0xf000 {
+			if len(b) < 4 {
+				return Instruction{}, ErrShortInput
+			}
+
+			set(OpLongI, Operand{Address, uint16(b[2])<<8 | uint16(b[3])})
+			ins.Len = 4
+			break
+		}
+
+		switch {
+		case nn.Value == 0x01:
+			set(OpPlane, Operand{Nibble, x.Value})
+		case op == 0xf002:
+			set(OpAudio)
+		default:
+			if o, ok := fxOps[nn.Value]; ok {
+				set(o, x)
+			}
+		}
+	}
+
+	return ins, nil
+}
+
+// Reports whether execution can carry on to the next instruction.
+func (ins Instruction) FallsThrough() bool {
+	switch ins.Op {
+	case OpInvalid, OpReturn, OpExit, OpJump, OpJump0:
+		return false
+	default:
+		return true
+	}
+}
+
+// Reports whether the instruction conditionally skips the next one.
+func (ins Instruction) IsSkip() bool {
+	switch ins.Op {
+	case OpSkipEqImm, OpSkipNeImm, OpSkipEqReg, OpSkipNeReg, OpSkipKey, OpSkipNotKey:
+		return true
+	default:
+		return false
+	}
+}
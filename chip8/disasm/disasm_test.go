@@ -0,0 +1,100 @@
+package disasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodesInstructions(t *testing.T) {
+	for _, tc := range []struct {
+		b    []byte
+		op   Op
+		octo string
+		len  int
+	}{
+		{[]byte{0x00, 0xe0}, OpClear, "clear", 2},
+		{[]byte{0x00, 0xc4}, OpScrollDown, "scroll-down 4", 2},
+		{[]byte{0x12, 0x34}, OpJump, "jump 0x234", 2},
+		{[]byte{0x3a, 0x10}, OpSkipEqImm, "if va != 0x10 then", 2},
+		{[]byte{0x52, 0x42}, OpSaveRange, "save v2 - v4", 2},
+		{[]byte{0x81, 0x27}, OpSubn, "v1 =- v2", 2},
+		{[]byte{0xd1, 0x25}, OpSprite, "sprite v1 v2 5", 2},
+		{[]byte{0xe3, 0x9e}, OpSkipKey, "if v3 -key then", 2},
+		{[]byte{0xf0, 0x00, 0x12, 0x34}, OpLongI, "i := long 0x1234", 4},
+		{[]byte{0xf3, 0x01}, OpPlane, "plane 3", 2},
+		{[]byte{0xf5, 0x30}, OpBigHex, "i := bighex v5", 2},
+		{[]byte{0x81, 0x28}, OpInvalid, "0x81 0x28", 2},
+	} {
+		ins, err := Decode(tc.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ins.Op != tc.op || ins.String() != tc.octo || ins.Len != tc.len {
+			t.Errorf("% x: got %v %q len %d", tc.b, ins.Op, ins.String(), ins.Len)
+		}
+	}
+}
+
+func TestDecodeRejectsShortInput(t *testing.T) {
+	if _, err := Decode([]byte{0xf0, 0x00, 0x12}); err != ErrShortInput {
+		t.Fail()
+	}
+}
+
+func TestHasMnemonicAndOperands(t *testing.T) {
+	ins, _ := Decode([]byte{0x7a, 0x03})
+
+	if ins.Mnemonic() != "ADD" || len(ins.Operands) != 2 ||
+		ins.Operands[0] != (Operand{Register, 0xa}) || ins.Operands[1] != (Operand{Byte, 3}) {
+		t.Fatalf("got %s %+v", ins.Mnemonic(), ins.Operands)
+	}
+}
+
+func TestLabelsTargetsAndEmitsData(t *testing.T) {
+	rom := []byte{
+		0xa2, 0x08, // i := data_208
+		0x22, 0x06, // sub_206
+		0x12, 0x04, // jump label_204
+		0x00, 0xee, // return
+		0xff, 0x81, // sprite data
+	}
+
+	var buf bytes.Buffer
+	_ = Disassemble(rom, 0x200).WriteOcto(&buf)
+
+	want := strings.Join([]string{
+		": main",
+		"\ti := data_208",
+		"\tsub_206",
+		"",
+		": label_204",
+		"\tjump label_204",
+		"",
+		": sub_206",
+		"\treturn",
+		"",
+		": data_208",
+		"\t0xff 0x81",
+		"",
+	}, "\n")
+
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFollowsBothSidesOfSkips(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // if v0 != 0x00 then
+		0x00, 0xfd, // exit
+		0x00, 0xee, // return
+	}
+
+	p := Disassemble(rom, 0x200)
+
+	if _, ok := p.Code[0x204]; !ok {
+		t.Fail()
+	}
+}
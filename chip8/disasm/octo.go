@@ -0,0 +1,115 @@
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Octo statements for each op. %s verbs are filled in with the
+// operands in order.
+var octoSyntax = [...]string{
+	OpClear:       "clear",
+	OpReturn:      "return",
+	OpScrollDown:  "scroll-down %s",
+	OpScrollUp:    "scroll-up %s",
+	OpScrollRight: "scroll-right",
+	OpScrollLeft:  "scroll-left",
+	OpExit:        "exit",
+	OpLores:       "lores",
+	OpHires:       "hires",
+	OpJump:        "jump %s",
+	OpCall:        ":call %s",
+	OpSkipEqImm:   "if %s != %s then",
+	OpSkipNeImm:   "if %s == %s then",
+	OpSkipEqReg:   "if %s != %s then",
+	OpSaveRange:   "save %s - %s",
+	OpLoadRange:   "load %s - %s",
+	OpSetImm:      "%s := %s",
+	OpAddImm:      "%s += %s",
+	OpSetReg:      "%s := %s",
+	OpOr:          "%s |= %s",
+	OpAnd:         "%s &= %s",
+	OpXor:         "%s ^= %s",
+	OpAdd:         "%s += %s",
+	OpSub:         "%s -= %s",
+	OpShr:         "%s >>= %s",
+	OpSubn:        "%s =- %s",
+	OpShl:         "%s <<= %s",
+	OpSkipNeReg:   "if %s == %s then",
+	OpSetI:        "i := %s",
+	OpJump0:       "jump0 %s",
+	OpRandom:      "%s := random %s",
+	OpSprite:      "sprite %s %s %s",
+	OpSkipKey:     "if %s -key then",
+	OpSkipNotKey:  "if %s key then",
+	OpLongI:       "i := long %s",
+	OpPlane:       "plane %s",
+	OpAudio:       "audio",
+	OpGetDelay:    "%s := delay",
+	OpWaitKey:     "%s := key",
+	OpSetDelay:    "delay := %s",
+	OpSetBuzzer:   "buzzer := %s",
+	OpAddI:        "i += %s",
+	OpHex:         "i := hex %s",
+	OpBigHex:      "i := bighex %s",
+	OpBCD:         "bcd %s",
+	OpPitch:       "pitch := %s",
+	OpSave:        "save %s",
+	OpLoad:        "load %s",
+	OpSaveFlags:   "saveflags %s",
+	OpLoadFlags:   "loadflags %s",
+}
+
+// Formats the instruction in Octo syntax.
+func (ins Instruction) String() string {
+	return ins.Octo(nil)
+}
+
+// Formats the instruction in Octo syntax, printing addresses that
+// have a label by name. Invalid instructions are printed as the
+// two data bytes they are made of.
+func (ins Instruction) Octo(labels map[uint16]string) string {
+	if ins.Op == OpInvalid {
+		return fmt.Sprintf("0x%02x 0x%02x", ins.Opcode>>8, ins.Opcode&0xff)
+	}
+
+	// Octo calls a subroutine by writing its name.
+	if ins.Op == OpCall {
+		if l, ok := labels[ins.Operands[0].Value]; ok {
+			return l
+		}
+	}
+
+	args := make([]any, len(ins.Operands))
+	for i, o := range ins.Operands {
+		args[i] = formatOperand(o, labels)
+	}
+
+	return fmt.Sprintf(octoSyntax[ins.Op], args...)
+}
+
+func formatOperand(o Operand, labels map[uint16]string) string {
+	switch o.Kind {
+	case Register:
+		return fmt.Sprintf("v%x", o.Value)
+	case Byte:
+		return fmt.Sprintf("0x%02x", o.Value)
+	case Nibble:
+		return fmt.Sprintf("%d", o.Value)
+	default:
+		if l, ok := labels[o.Value]; ok {
+			return l
+		}
+		return fmt.Sprintf("0x%03x", o.Value)
+	}
+}
+
+// Formats bytes as an Octo data line.
+func formatBytes(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("0x%02x", v)
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,160 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// How many data bytes go on one line of output.
+const bytesPerLine = 8
+
+// A disassembled ROM.
+type Program struct {
+	// Where the ROM is loaded, normally 0x200.
+	Origin uint16
+
+	ROM []byte
+
+	// The instructions reachable from the entry point by address.
+	// Every other byte is data.
+	Code map[uint16]Instruction
+
+	// Names for jump and call targets, and for addresses that I
+	// points at.
+	Labels map[uint16]string
+}
+
+// How labels are prefixed, in order of precedence when an address
+// is referred to in several ways.
+var labelPrefixes = []string{"main", "sub", "label", "data"}
+
+// Disassembles a ROM loaded at origin by following the code that
+// can be reached from its first instruction.
+func Disassemble(rom []byte, origin uint16) *Program {
+	p := &Program{
+		Origin: origin,
+		ROM:    rom,
+		Code:   map[uint16]Instruction{},
+		Labels: map[uint16]string{},
+	}
+
+	rank := map[uint16]int{}
+	label := func(addr uint16, prefix int) {
+		if !p.contains(addr) {
+			return
+		}
+
+		if r, ok := rank[addr]; ok && r <= prefix {
+			return
+		}
+
+		rank[addr] = prefix
+		if prefix == 0 {
+			p.Labels[addr] = labelPrefixes[0]
+		} else {
+			p.Labels[addr] = fmt.Sprintf("%s_%03x", labelPrefixes[prefix], addr)
+		}
+	}
+
+	label(origin, 0)
+
+	work := []uint16{origin}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if _, seen := p.Code[addr]; seen || !p.contains(addr) {
+			continue
+		}
+
+		ins, err := Decode(rom[addr-origin:])
+		if err != nil || ins.Op == OpInvalid {
+			continue
+		}
+		p.Code[addr] = ins
+
+		next := addr + uint16(ins.Len)
+
+		switch ins.Op {
+		case OpJump:
+			label(ins.Operands[0].Value, 2)
+			work = append(work, ins.Operands[0].Value)
+		case OpCall:
+			label(ins.Operands[0].Value, 1)
+			work = append(work, ins.Operands[0].Value)
+		case OpSetI, OpLongI:
+			label(ins.Operands[0].Value, 3)
+		}
+
+		if ins.IsSkip() && p.contains(next) {
+			if skipped, err := Decode(rom[next-origin:]); err == nil {
+				work = append(work, next+uint16(skipped.Len))
+			}
+		}
+
+		if ins.FallsThrough() {
+			work = append(work, next)
+		}
+	}
+
+	return p
+}
+
+// Reports whether addr is inside the ROM.
+func (p *Program) contains(addr uint16) bool {
+	return addr >= p.Origin && int(addr-p.Origin) < len(p.ROM)
+}
+
+// Reports whether an instruction can be printed at addr without
+// swallowing a label or another instruction.
+func (p *Program) printable(addr uint16, ins Instruction) bool {
+	for a := addr + 1; a < addr+uint16(ins.Len); a++ {
+		if _, ok := p.Labels[a]; ok {
+			return false
+		}
+		if _, ok := p.Code[a]; ok {
+			return false
+		}
+	}
+
+	return p.contains(addr + uint16(ins.Len) - 1)
+}
+
+// Writes the program as Octo source that assembles back to the
+// same bytes.
+func (p *Program) WriteOcto(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for addr := p.Origin; p.contains(addr); {
+		if l, ok := p.Labels[addr]; ok {
+			if addr != p.Origin {
+				bw.WriteString("\n")
+			}
+			fmt.Fprintf(bw, ": %s\n", l)
+		}
+
+		if ins, ok := p.Code[addr]; ok && p.printable(addr, ins) {
+			fmt.Fprintf(bw, "\t%s\n", ins.Octo(p.Labels))
+			addr += uint16(ins.Len)
+			continue
+		}
+
+		// Gather data up to the next label or instruction.
+		end := addr + 1
+		for p.contains(end) && end-addr < bytesPerLine {
+			if _, ok := p.Labels[end]; ok {
+				break
+			}
+			if _, ok := p.Code[end]; ok {
+				break
+			}
+			end++
+		}
+
+		fmt.Fprintf(bw, "\t%s\n", formatBytes(p.ROM[addr-p.Origin:end-p.Origin]))
+		addr = end
+	}
+
+	return bw.Flush()
+}
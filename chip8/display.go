@@ -0,0 +1,144 @@
+package chip8
+
+// A row of pixels, one bit each. The most significant bit of the
+// first word is the leftmost pixel, so lo-res rows only use the
+// first word.
+type row [2]uint64
+
+// The display, stored as one bitset per XO-CHIP drawing plane.
+// Platforms without planes only ever use the first.
+type Frame struct {
+	// Set whenever the picture changes. Renderers clear it once
+	// they have drawn the frame so unchanged frames can be
+	// skipped.
+	Dirty bool
+
+	planes [2][HiResRows]row
+
+	// Set by 00FF and cleared by 00FE on SUPER-CHIP.
+	hires bool
+}
+
+// Returns the display. See Frame.Dirty.
+func (vm *VM) Frame() *Frame {
+	return &vm.display
+}
+
+// Returns the width and height of the display in the current
+// resolution.
+func (f *Frame) Size() (int, int) {
+	if f.hires {
+		return HiResCols, HiResRows
+	}
+
+	return Cols, Rows
+}
+
+// Returns the pixel at (x, y) with a bit set for each plane it is
+// lit on, so on XO-CHIP the values 0-3 are the colour to render.
+func (f *Frame) Pixel(x, y int) uint8 {
+	word, bit := x/64, 63-x%64
+
+	p0 := f.planes[0][y][word] >> bit & 1
+	p1 := f.planes[1][y][word] >> bit & 1
+
+	return uint8(p0 | p1<<1)
+}
+
+// Switches between lo-res and hi-res, wiping every plane first if
+// clear is set.
+func (f *Frame) setHires(hires, clear bool) {
+	f.hires = hires
+	if clear {
+		f.planes = [2][HiResRows]row{}
+	}
+	f.Dirty = true
+}
+
+// XORs line onto row y of the plane. Reports whether any lit pixel
+// got erased.
+func (f *Frame) xor(plane, y int, line row) bool {
+	r := &f.planes[plane][y]
+	erased := r[0]&line[0] != 0 || r[1]&line[1] != 0
+
+	r[0] ^= line[0]
+	r[1] ^= line[1]
+	f.Dirty = true
+
+	return erased
+}
+
+// Clears the selected planes.
+func (f *Frame) clear(planes uint8) {
+	for plane := range f.planes {
+		if planes&(1<<plane) != 0 {
+			f.planes[plane] = [HiResRows]row{}
+		}
+	}
+	f.Dirty = true
+}
+
+// Shifts the selected planes by dx pixels to the right and dy
+// pixels down. Pixels shifted in from the edges are blank.
+func (f *Frame) scroll(planes uint8, dx, dy int) {
+	cols, rows := f.Size()
+	mask := shiftRow(row{^uint64(0), ^uint64(0)}, cols-HiResCols)
+
+	for plane := range f.planes {
+		if planes&(1<<plane) == 0 {
+			continue
+		}
+
+		var scrolled [HiResRows]row
+		for y := 0; y < rows; y++ {
+			if sy := y - dy; sy >= 0 && sy < rows {
+				r := shiftRow(f.planes[plane][sy], dx)
+				scrolled[y] = row{r[0] & mask[0], r[1] & mask[1]}
+			}
+		}
+		f.planes[plane] = scrolled
+	}
+	f.Dirty = true
+}
+
+// Returns the sprite row bits, w pixels wide, placed at x on a
+// cols wide display. Pixels past the right edge wrap around to the
+// left unless clip is set.
+func spriteRow(bits uint16, w, x, cols int, clip bool) row {
+	var r row
+
+	for col := 0; col < w; col++ {
+		if bits>>(w-1-col)&1 == 0 {
+			continue
+		}
+
+		px := x + col
+		if px >= cols {
+			if clip {
+				break
+			}
+			px %= cols
+		}
+
+		r[px/64] |= 1 << (63 - px%64)
+	}
+
+	return r
+}
+
+// Shifts r by n pixels to the right, or to the left if n is
+// negative.
+func shiftRow(r row, n int) row {
+	switch {
+	case n >= 64:
+		return row{0, r[0] >> (n - 64)}
+	case n > 0:
+		return row{r[0] >> n, r[1]>>n | r[0]<<(64-n)}
+	case n <= -64:
+		return row{r[1] << (-n - 64), 0}
+	case n < 0:
+		return row{r[0]<<-n | r[1]>>(64+n), r[1] << -n}
+	default:
+		return r
+	}
+}
@@ -0,0 +1,82 @@
+package chip8
+
+import "testing"
+
+// Lights or clears (x, y) on each plane according to planes.
+func (f *Frame) set(x, y int, planes uint8) {
+	for plane := range f.planes {
+		r := &f.planes[plane][y]
+		bit := uint64(1) << (63 - x%64)
+
+		if planes&(1<<plane) != 0 {
+			r[x/64] |= bit
+		} else {
+			r[x/64] &^= bit
+		}
+	}
+}
+
+func TestDrawingMarksTheFrameDirty(t *testing.T) {
+	c8 := New()
+	c8.ir = 0x300
+	c8.memory[0x300] = 0x80
+
+	f := c8.Frame()
+	f.Dirty = false
+
+	_ = c8.exec(0x6501)
+	if f.Dirty {
+		t.Fatal("dirty without drawing")
+	}
+
+	_ = c8.exec(0xd011)
+	if !f.Dirty || f.Pixel(0, 0) != 1 {
+		t.Fail()
+	}
+}
+
+func TestSpritesWrapAcrossWords(t *testing.T) {
+	sc := New(WithPlatform(SuperChip), WithQuirks(Quirks{}))
+	sc.display.setHires(true, true)
+	sc.ir = 0x300
+	sc.memory[0x300] = 0xff
+	sc.memory[0x301] = 0xff
+	sc.registers[0] = 60
+	sc.registers[2] = 124
+
+	// An 8 pixel sprite straddling the two words of a row.
+	_ = sc.exec(0xd011)
+
+	for x := 60; x < 68; x++ {
+		if sc.display.Pixel(x, 0) != 1 {
+			t.Fatalf("pixel %d is off", x)
+		}
+	}
+
+	// And one wrapping around the right edge.
+	_ = sc.exec(0xd211)
+
+	if sc.display.Pixel(127, 0) != 1 || sc.display.Pixel(3, 0) != 1 || sc.display.Pixel(4, 0) != 0 {
+		t.Fail()
+	}
+}
+
+func TestScrollingRightDropsPixelsPastTheEdge(t *testing.T) {
+	sc := New(WithPlatform(SuperChip))
+	sc.display.set(62, 0, 1)
+
+	_ = sc.exec(0x00fb)
+
+	// Lo-res rows must not spill into the hi-res half.
+	sc.display.setHires(true, false)
+	if sc.display.Pixel(66, 0) != 0 {
+		t.Fail()
+	}
+
+	sc.display.set(62, 1, 1)
+	_ = sc.exec(0x00fb)
+
+	if sc.display.Pixel(66, 1) != 1 {
+		t.Fail()
+	}
+}
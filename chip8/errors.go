@@ -0,0 +1,42 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The faults a program can run into. Cycle returns them wrapped in
+// a *Fault, so check for them with errors.Is.
+var (
+	ErrStackOverflow  = errors.New("Stack overflow.")
+	ErrStackUnderflow = errors.New("Stack underflow.")
+	ErrMemoryBounds   = errors.New("Memory access out of bounds.")
+	ErrUnknownOpcode  = errors.New("Unknown opcode.")
+)
+
+// A fault raised by the program running in the vm, along with the
+// address and opcode of the instruction that raised it.
+type Fault struct {
+	Err    error
+	PC     uint16
+	Opcode uint16
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("Fault at %03x executing '%04x': %s", f.PC, f.Opcode, f.Err)
+}
+
+func (f *Fault) Unwrap() error {
+	return f.Err
+}
+
+// Returns a fault for the instruction at the program counter.
+func (vm *VM) fault(err error, ins uint16) error {
+	return &Fault{Err: err, PC: vm.pc, Opcode: ins}
+}
+
+// Reports whether n bytes starting at addr are within the memory
+// the platform can address.
+func (vm *VM) inBounds(addr uint16, n int) bool {
+	return int(addr)+n <= vm.platform.MemorySize()
+}
@@ -0,0 +1,44 @@
+package chip8
+
+// A copy of the vm's registers, for debuggers and other tooling.
+type Registers struct {
+	V  [16]uint8
+	I  uint16
+	PC uint16
+
+	// The number of return addresses on the stack and the
+	// addresses themselves, oldest first.
+	SP    uint8
+	Stack [16]uint16
+
+	DT uint8
+	ST uint8
+}
+
+// Returns a snapshot of the registers.
+func (vm *VM) Registers() Registers {
+	return Registers{
+		V:     vm.registers,
+		I:     vm.ir,
+		PC:    vm.pc,
+		SP:    vm.sp,
+		Stack: vm.stack,
+		DT:    vm.dt,
+		ST:    vm.st,
+	}
+}
+
+// Returns a copy of n bytes of memory starting at addr, cut short
+// at the end of the memory the platform can address.
+func (vm *VM) ReadMemory(addr uint16, n int) []byte {
+	end := int(addr) + n
+	if size := vm.platform.MemorySize(); end > size {
+		end = size
+	}
+
+	if int(addr) >= end {
+		return nil
+	}
+
+	return append([]byte(nil), vm.memory[addr:end]...)
+}
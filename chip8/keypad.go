@@ -0,0 +1,103 @@
+package chip8
+
+// The keys of the hex keypad, 0x0 to 0xF.
+type Key uint8
+
+// Bounds the events queued up while the vm is not running.
+const maxKeyEvents = 64
+
+type keyEvent struct {
+	key  Key
+	down bool
+}
+
+// The 16 key hex keypad. Frontends report presses and releases,
+// which are queued and applied as the vm runs, so a tap shorter
+// than a frame is still seen by the program.
+type Keypad struct {
+	// The keys held down as the program sees them, one bit per
+	// key.
+	state uint16
+
+	queue []keyEvent
+}
+
+// Queues a key press.
+func (kp *Keypad) Press(k Key) {
+	kp.push(keyEvent{k & 0xf, true})
+}
+
+// Queues a key release.
+func (kp *Keypad) Release(k Key) {
+	kp.push(keyEvent{k & 0xf, false})
+}
+
+// Queues presses and releases for every key whose state differs
+// from mask, as the program will see it once the queue is applied.
+// Handy for frontends that poll or replay the whole keypad.
+func (kp *Keypad) SetState(mask uint16) {
+	want := kp.pendingState() ^ mask
+
+	for k := Key(0); k < 16; k++ {
+		if want&(1<<k) != 0 {
+			kp.push(keyEvent{k, mask&(1<<k) != 0})
+		}
+	}
+}
+
+// Reports whether the program sees k as held down.
+func (kp *Keypad) IsPressed(k Key) bool {
+	return kp.state&(1<<(k&0xf)) != 0
+}
+
+// Returns the keys the program sees as held down, one bit per
+// key.
+func (kp *Keypad) State() uint16 {
+	return kp.state
+}
+
+func (kp *Keypad) push(e keyEvent) {
+	if len(kp.queue) == maxKeyEvents {
+		kp.queue = kp.queue[1:]
+	}
+
+	kp.queue = append(kp.queue, e)
+}
+
+// Returns the state once every queued event has been applied.
+func (kp *Keypad) pendingState() uint16 {
+	state := kp.state
+	for _, e := range kp.queue {
+		if e.down {
+			state |= 1 << e.key
+		} else {
+			state &^= 1 << e.key
+		}
+	}
+
+	return state
+}
+
+// Applies queued events up to the first one for a key that has
+// already changed, so a press and its release are never applied
+// together and every press is visible to at least one
+// instruction.
+func (kp *Keypad) update() {
+	var changed uint16
+
+	for len(kp.queue) > 0 {
+		e := kp.queue[0]
+		bit := uint16(1) << e.key
+		if changed&bit != 0 {
+			break
+		}
+
+		changed |= bit
+		if e.down {
+			kp.state |= bit
+		} else {
+			kp.state &^= bit
+		}
+		kp.queue = kp.queue[1:]
+	}
+}
@@ -0,0 +1,64 @@
+package chip8
+
+import "testing"
+
+func TestKeypadAppliesEventsOnCycle(t *testing.T) {
+	var kp Keypad
+
+	kp.Press(3)
+	if kp.IsPressed(3) {
+		t.Fatal("applied before the vm ran")
+	}
+
+	kp.update()
+	if !kp.IsPressed(3) || kp.State() != 1<<3 {
+		t.Fatalf("got %04x", kp.State())
+	}
+}
+
+func TestKeypadNeverMergesTapIntoOneCycle(t *testing.T) {
+	var kp Keypad
+
+	kp.Press(5)
+	kp.Press(6)
+	kp.Release(5)
+
+	kp.update()
+	if kp.State() != 1<<5|1<<6 {
+		t.Fatalf("got %04x", kp.State())
+	}
+
+	kp.update()
+	if kp.State() != 1<<6 {
+		t.Fatalf("got %04x", kp.State())
+	}
+}
+
+func TestKeypadSetStateQueuesChanges(t *testing.T) {
+	var kp Keypad
+
+	kp.SetState(1<<1 | 1<<2)
+	kp.SetState(1<<1 | 1<<2)
+	if len(kp.queue) != 2 {
+		t.Fatalf("got %d events", len(kp.queue))
+	}
+
+	kp.update()
+	kp.SetState(1 << 2)
+	kp.update()
+	if kp.State() != 1<<2 {
+		t.Fatalf("got %04x", kp.State())
+	}
+}
+
+func TestSkipsOnKeypadState(t *testing.T) {
+	c8 := New()
+	c8.registers[1] = 0xa
+	c8.Keypad.Press(0xa)
+	c8.Keypad.update()
+
+	_ = c8.exec(0xe19e)
+	if c8.pc != 0x204 {
+		t.Fatalf("got pc %03x", c8.pc)
+	}
+}
@@ -0,0 +1,41 @@
+package chip8
+
+// Configures optional vm settings in New.
+type Option func(*VM)
+
+// Seeds the random number generator used by CXNN, making runs
+// reproducible. Without it the vm is seeded from the clock.
+func WithSeed(seed uint64) Option {
+	return func(vm *VM) {
+		vm.rand.state = seed
+	}
+}
+
+// Sets where the vm sends its sound. Without it the vm is silent.
+func WithAudio(sink AudioSink) Option {
+	return func(vm *VM) {
+		vm.audio = sink
+	}
+}
+
+// Sets the platform to emulate. Defaults to Chip8.
+func WithPlatform(p Platform) Option {
+	return func(vm *VM) {
+		vm.platform = p
+	}
+}
+
+// Sets the quirks to follow instead of the platform's defaults.
+func WithQuirks(q Quirks) Option {
+	return func(vm *VM) {
+		vm.quirks = q
+		vm.quirksSet = true
+	}
+}
+
+// Sends an event to t for every instruction executed.
+func WithTracer(t Tracer) Option {
+	return func(vm *VM) {
+		vm.tracer = t
+	}
+}
@@ -0,0 +1,58 @@
+package chip8
+
+import "fmt"
+
+// The flavour of CHIP-8 the vm emulates. Each platform is a
+// superset of the ones before it, so comparisons such as
+// `vm.platform >= SuperChip` are used to gate extensions.
+type Platform uint8
+
+const (
+	// The original COSMAC VIP interpreter.
+	Chip8 Platform = iota
+
+	// SUPER-CHIP 1.1 as found on the HP48 calculators. Adds the
+	// 128x64 hi-res mode, scrolling, big font and RPL flags.
+	SuperChip
+
+	// XO-CHIP as defined by Octo. Adds 64 KiB of memory, two
+	// drawing planes and programmable audio.
+	XOChip
+)
+
+func (p Platform) String() string {
+	switch p {
+	case Chip8:
+		return "chip8"
+	case SuperChip:
+		return "schip"
+	case XOChip:
+		return "xochip"
+	default:
+		return fmt.Sprintf("Platform(%d)", uint8(p))
+	}
+}
+
+// Returns how many bytes of memory the platform can address.
+func (p Platform) MemorySize() int {
+	if p >= XOChip {
+		return 0x10000
+	}
+
+	return 0x1000
+}
+
+// Returns the platform matching the given name as printed by
+// Platform.String.
+func ParsePlatform(s string) (Platform, error) {
+	switch s {
+	case "chip8":
+		return Chip8, nil
+	case "schip":
+		return SuperChip, nil
+	case "xochip":
+		return XOChip, nil
+	default:
+		return Chip8, fmt.Errorf("Unknown platform: %q", s)
+	}
+}
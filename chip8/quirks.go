@@ -0,0 +1,114 @@
+package chip8
+
+import "fmt"
+
+// How FX55 and FX65 leave the index register once they are done.
+type IndexIncrement uint8
+
+const (
+	// I is left untouched.
+	IncrementNone IndexIncrement = iota
+
+	// I ends up at I + X, as on the CHIP-48.
+	IncrementX
+
+	// I ends up at I + X + 1, as on the COSMAC VIP.
+	IncrementXPlus1
+)
+
+// The ambiguous behaviours that differ between CHIP-8
+// interpreters. The zero value shifts in place, leaves I alone,
+// jumps with V0, wraps sprites and never resets VF.
+type Quirks struct {
+	// 8XY6 and 8XYE shift vY into vX instead of shifting vX
+	// in place.
+	ShiftUsesVY bool
+
+	// How FX55 and FX65 move I.
+	MemoryIncrement IndexIncrement
+
+	// BNNN jumps to XNN + vX instead of NNN + v0.
+	JumpUsesVX bool
+
+	// DXYN clips sprites at the edges of the display instead of
+	// wrapping them around.
+	Clip bool
+
+	// 8XY1, 8XY2 and 8XY3 reset VF to 0.
+	LogicResetsVF bool
+
+	// FX1E sets VF when I goes past 0xFFF.
+	IndexOverflowSetsVF bool
+
+	// 00FE and 00FF clear the display when switching resolution.
+	ResolutionChangeClears bool
+}
+
+var (
+	// The original COSMAC VIP interpreter.
+	QuirksVIP = Quirks{
+		ShiftUsesVY:     true,
+		MemoryIncrement: IncrementXPlus1,
+		Clip:            true,
+		LogicResetsVF:   true,
+	}
+
+	// The CHIP-48 interpreter for the HP48.
+	QuirksCHIP48 = Quirks{
+		MemoryIncrement: IncrementX,
+		JumpUsesVX:      true,
+		Clip:            true,
+	}
+
+	// SUPER-CHIP as most modern interpreters and Octo run it.
+	QuirksSuperChipModern = Quirks{
+		JumpUsesVX:             true,
+		Clip:                   true,
+		ResolutionChangeClears: true,
+	}
+
+	// SUPER-CHIP 1.1 as it behaved on the HP48, which kept the
+	// display around when switching resolution.
+	QuirksSuperChipLegacy = Quirks{
+		JumpUsesVX: true,
+		Clip:       true,
+	}
+
+	// XO-CHIP as defined by Octo.
+	QuirksXOChip = Quirks{
+		ShiftUsesVY:            true,
+		MemoryIncrement:        IncrementXPlus1,
+		ResolutionChangeClears: true,
+	}
+)
+
+// Returns the quirks preset with the given name. The names are
+// vip, chip48, schip-modern, schip-legacy and xochip.
+func ParseQuirks(s string) (Quirks, error) {
+	switch s {
+	case "vip":
+		return QuirksVIP, nil
+	case "chip48":
+		return QuirksCHIP48, nil
+	case "schip-modern":
+		return QuirksSuperChipModern, nil
+	case "schip-legacy":
+		return QuirksSuperChipLegacy, nil
+	case "xochip":
+		return QuirksXOChip, nil
+	default:
+		return Quirks{}, fmt.Errorf("Unknown quirks preset: %q", s)
+	}
+}
+
+// Returns the quirks most ROMs written for the platform expect.
+func DefaultQuirks(p Platform) Quirks {
+	switch p {
+	case SuperChip:
+		return QuirksSuperChipModern
+	case XOChip:
+		return QuirksXOChip
+	default:
+		return QuirksVIP
+	}
+}
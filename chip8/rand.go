@@ -0,0 +1,23 @@
+package chip8
+
+// The random number generator behind CXNN. It is a splitmix64
+// generator, whose whole state is a single word, so runs can be
+// replayed from a seed and the state fits in a save state.
+type rng struct {
+	state uint64
+}
+
+func (r *rng) next() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
+
+// Returns a uniformly distributed byte.
+func (r *rng) byte() uint8 {
+	return uint8(r.next() >> 56)
+}
@@ -0,0 +1,157 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Written at the start of every save state.
+var stateMagic = [4]byte{'G', 'C', '8', 'S'}
+
+// Bumped whenever the layout of savedState changes. States written
+// by other versions are rejected.
+const stateVersion uint16 = 5
+
+var (
+	ErrInvalidState = errors.New("Save state is corrupt or not a save state.")
+	ErrStateVersion = errors.New("Save state was written by an incompatible version.")
+)
+
+// Everything needed to resume the vm. Only fixed size fields so
+// it can be written in one go with encoding/binary.
+type savedState struct {
+	Platform Platform
+	Quirks   Quirks
+
+	Memory    [0x10000]uint8
+	Registers [16]uint8
+	Stack     [16]uint16
+
+	Pc uint16
+	Ir uint16
+	Sp uint8
+	Dt uint8
+	St uint8
+
+	Display [2][HiResRows]row
+	Keys    uint16
+	WaitKey int8
+
+	Hires  bool
+	Exited bool
+	Rpl    [16]uint8
+
+	Planes  uint8
+	Pattern [16]uint8
+	Pitch   uint8
+
+	Rand uint64
+}
+
+// Writes a snapshot of the whole vm to w. The format is the magic
+// header, a version, the state and a CRC-32 of everything before
+// it.
+func (vm *VM) SaveState(w io.Writer) error {
+	s := savedState{
+		Platform:  vm.platform,
+		Quirks:    vm.quirks,
+		Memory:    vm.memory,
+		Registers: vm.registers,
+		Stack:     vm.stack,
+		Pc:        vm.pc,
+		Ir:        vm.ir,
+		Sp:        vm.sp,
+		Dt:        vm.dt,
+		St:        vm.st,
+		Display:   vm.display.planes,
+		Keys:      vm.Keypad.state,
+		WaitKey:   vm.waitKey,
+		Hires:     vm.display.hires,
+		Exited:    vm.exited,
+		Rpl:       vm.rpl,
+		Planes:    vm.planes,
+		Pattern:   vm.pattern,
+		Pitch:     vm.pitch,
+		Rand:      vm.rand.state,
+	}
+
+	var buf bytes.Buffer
+	buf.Write(stateMagic[:])
+	_ = binary.Write(&buf, binary.LittleEndian, stateVersion)
+	_ = binary.Write(&buf, binary.LittleEndian, &s)
+	_ = binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Restores a snapshot written by SaveState. The vm is left
+// untouched if the state is rejected.
+func (vm *VM) LoadState(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if len(b) < len(stateMagic)+2+4 || !bytes.Equal(b[:len(stateMagic)], stateMagic[:]) {
+		return ErrInvalidState
+	}
+
+	if binary.LittleEndian.Uint16(b[len(stateMagic):]) != stateVersion {
+		return ErrStateVersion
+	}
+
+	body, sum := b[:len(b)-4], binary.LittleEndian.Uint32(b[len(b)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return ErrInvalidState
+	}
+
+	var s savedState
+	if len(body) != len(stateMagic)+2+binary.Size(&s) {
+		return ErrInvalidState
+	}
+
+	br := bytes.NewReader(body[len(stateMagic)+2:])
+	if err := binary.Read(br, binary.LittleEndian, &s); err != nil {
+		return ErrInvalidState
+	}
+
+	// The checksum only catches corruption. A stack pointer past
+	// the stack would panic on the next call or return.
+	if int(s.Sp) > len(s.Stack) {
+		return ErrInvalidState
+	}
+
+	vm.platform = s.Platform
+	vm.quirks = s.Quirks
+	vm.memory = s.Memory
+	vm.registers = s.Registers
+	vm.stack = s.Stack
+	vm.pc = s.Pc
+	vm.ir = s.Ir
+	vm.sp = s.Sp
+	vm.dt = s.Dt
+	vm.st = s.St
+	vm.display = Frame{Dirty: true, planes: s.Display, hires: s.Hires}
+	vm.Keypad.state = s.Keys
+	// Keys queued before the load belong to the state left behind.
+	vm.Keypad.queue = nil
+	vm.waitKey = s.WaitKey
+	vm.exited = s.Exited
+	vm.rpl = s.Rpl
+	vm.planes = s.Planes
+	vm.pattern = s.Pattern
+	vm.pitch = s.Pitch
+	vm.rand.state = s.Rand
+
+	// The platform and quirks may have changed along with the
+	// memory.
+	vm.invalidateAll()
+	vm.updateSound()
+	vm.updatePattern()
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRestoresSavedState(t *testing.T) {
+	src := New(WithPlatform(XOChip))
+	_ = src.LoadRom([]byte{0x60, 0x2a, 0xa3, 0x00, 0x00, 0xff})
+	for i := 0; i < 3; i++ {
+		_ = src.Cycle()
+	}
+	src.display.set(100, 60, 3)
+	src.dt = 9
+
+	var buf bytes.Buffer
+	if err := src.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := New(WithQuirks(QuirksVIP))
+	if err := dst.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.registers[0] != 0x2a || dst.ir != 0x300 || dst.pc != 0x206 ||
+		!dst.display.hires || dst.dt != 9 || dst.display.Pixel(100, 60) != 3 ||
+		dst.Platform() != XOChip || dst.Quirks() != QuirksXOChip {
+		t.Fail()
+	}
+
+	_ = src.exec(0xc1ff)
+	_ = dst.exec(0xc1ff)
+	if src.registers[1] != dst.registers[1] {
+		t.Fatal("random state was not restored")
+	}
+}
+
+func TestRejectsCorruptState(t *testing.T) {
+	src := New(WithQuirks(QuirksVIP))
+
+	var buf bytes.Buffer
+	_ = src.SaveState(&buf)
+	b := buf.Bytes()
+	b[100] ^= 0xff
+
+	dst := New(WithQuirks(QuirksVIP))
+	dst.pc = 0x300
+	if err := dst.LoadState(bytes.NewReader(b)); err != ErrInvalidState {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+
+	if dst.pc != 0x300 {
+		t.Fail()
+	}
+}
+
+func TestRejectsOtherVersions(t *testing.T) {
+	src := New(WithQuirks(QuirksVIP))
+
+	var buf bytes.Buffer
+	_ = src.SaveState(&buf)
+	b := buf.Bytes()
+	b[4]++
+
+	if err := src.LoadState(bytes.NewReader(b)); err != ErrStateVersion {
+		t.Fatalf("got %v, want ErrStateVersion", err)
+	}
+}
+
+func TestRejectsOtherFiles(t *testing.T) {
+	if err := vm.LoadState(bytes.NewReader([]byte("not a state"))); err != ErrInvalidState {
+		t.Fail()
+	}
+}
+
+func TestRejectsStackPointerPastStack(t *testing.T) {
+	src := New(WithQuirks(QuirksVIP))
+	src.sp = uint8(len(src.stack) + 1)
+
+	var buf bytes.Buffer
+	_ = src.SaveState(&buf)
+
+	dst := New(WithQuirks(QuirksVIP))
+	if err := dst.LoadState(&buf); err != ErrInvalidState {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+
+	if dst.sp != 0 {
+		t.Fail()
+	}
+}
+
+func TestLoadStateDropsQueuedKeys(t *testing.T) {
+	src := New(WithQuirks(QuirksVIP))
+	_ = src.LoadRom([]byte{0x12, 0x00})
+
+	var buf bytes.Buffer
+	_ = src.SaveState(&buf)
+
+	dst := New(WithQuirks(QuirksVIP))
+	_ = dst.LoadRom([]byte{0x12, 0x00})
+	dst.Keypad.Press(5)
+	if err := dst.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = dst.Cycle()
+	if dst.Keypad.IsPressed(5) {
+		t.Fatal("key pressed before the load leaked into the restored state")
+	}
+}
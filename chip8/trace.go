@@ -0,0 +1,247 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oliveira-a/gochip/chip8/disasm"
+)
+
+// Receives an event for every instruction the vm executes, see
+// WithTracer. The event is reused between calls so copy it to keep
+// it around.
+type Tracer interface {
+	Trace(e *TraceEvent)
+}
+
+// One executed instruction.
+type TraceEvent struct {
+	PC     uint16
+	Opcode uint16
+
+	// The instruction decoded by chip8/disasm, such as "LD" and
+	// "v3 := 0x10". Both are empty if it could not be decoded.
+	Mnemonic string
+	Text     string
+
+	Before Registers
+	After  Registers
+
+	// The fault the instruction raised, if any.
+	Err error
+}
+
+// Executes ins and reports it to the tracer.
+func (vm *VM) traceExec(ins uint16) error {
+	e := TraceEvent{
+		PC:     vm.pc,
+		Opcode: ins,
+		Before: vm.Registers(),
+	}
+
+	if d, err := disasm.Decode(vm.ReadMemory(vm.pc, 4)); err == nil {
+		e.Mnemonic = d.Mnemonic()
+		e.Text = d.String()
+	}
+
+	e.Err = vm.exec(ins)
+	e.After = vm.Registers()
+	vm.tracer.Trace(&e)
+
+	return e.Err
+}
+
+// Writes a line per instruction with the registers it changed:
+//
+//	0200 6310 LD   v3 := 0x10           V3=10
+type TextTracer struct {
+	w io.Writer
+}
+
+// Returns a tracer writing text to w.
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+func (t *TextTracer) Trace(e *TraceEvent) {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%04x %04x %-4s %-20s", e.PC, e.Opcode, e.Mnemonic, e.Text)
+
+	for i := range e.After.V {
+		if e.Before.V[i] != e.After.V[i] {
+			fmt.Fprintf(&sb, " V%X=%02x", i, e.After.V[i])
+		}
+	}
+	if e.Before.I != e.After.I {
+		fmt.Fprintf(&sb, " I=%04x", e.After.I)
+	}
+	if e.Before.SP != e.After.SP {
+		fmt.Fprintf(&sb, " SP=%x", e.After.SP)
+	}
+	if e.Before.DT != e.After.DT {
+		fmt.Fprintf(&sb, " DT=%02x", e.After.DT)
+	}
+	if e.Before.ST != e.After.ST {
+		fmt.Fprintf(&sb, " ST=%02x", e.After.ST)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&sb, " ! %s", e.Err)
+	}
+
+	fmt.Fprintln(t.w, strings.TrimRight(sb.String(), " "))
+}
+
+// Writes each event as a line of JSON.
+type JSONTracer struct {
+	enc *json.Encoder
+}
+
+// Returns a tracer writing JSON lines to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+type jsonEvent struct {
+	PC       uint16    `json:"pc"`
+	Opcode   uint16    `json:"opcode"`
+	Mnemonic string    `json:"mnemonic,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	Before   Registers `json:"before"`
+	After    Registers `json:"after"`
+	Err      string    `json:"error,omitempty"`
+}
+
+func (t *JSONTracer) Trace(e *TraceEvent) {
+	je := jsonEvent{
+		PC:       e.PC,
+		Opcode:   e.Opcode,
+		Mnemonic: e.Mnemonic,
+		Text:     e.Text,
+		Before:   e.Before,
+		After:    e.After,
+	}
+	if e.Err != nil {
+		je.Err = e.Err.Error()
+	}
+
+	_ = t.enc.Encode(je)
+}
+
+// The magic number starting a binary trace.
+const traceMagic = "GC8T"
+
+var ErrInvalidTrace = errors.New("Not a gochip trace.")
+
+// A fixed size record in a binary trace. The registers before an
+// instruction are the ones after the previous record, so only
+// those after are stored.
+type traceRecord struct {
+	PC     uint16
+	Opcode uint16
+
+	// The second half of F000 NNNN.
+	Next uint16
+
+	Faulted uint8
+
+	V  [16]uint8
+	I  uint16
+	SP uint8
+	DT uint8
+	ST uint8
+}
+
+// Writes a compact binary trace: the magic "GC8T" followed by a
+// 28 byte little endian record per instruction. See
+// ReadBinaryTrace.
+type BinaryTracer struct {
+	w       io.Writer
+	started bool
+}
+
+// Returns a tracer writing a binary trace to w.
+func NewBinaryTracer(w io.Writer) *BinaryTracer {
+	return &BinaryTracer{w: w}
+}
+
+func (t *BinaryTracer) Trace(e *TraceEvent) {
+	if !t.started {
+		t.started = true
+		_, _ = io.WriteString(t.w, traceMagic)
+	}
+
+	r := traceRecord{
+		PC:     e.PC,
+		Opcode: e.Opcode,
+		V:      e.After.V,
+		I:      e.After.I,
+		SP:     e.After.SP,
+		DT:     e.After.DT,
+		ST:     e.After.ST,
+	}
+	if e.Opcode == 0xf000 {
+		// i := long leaves its operand in I.
+		r.Next = e.After.I
+	}
+	if e.Err != nil {
+		r.Faulted = 1
+	}
+
+	_ = binary.Write(t.w, binary.LittleEndian, &r)
+}
+
+// Reads a trace written by BinaryTracer, calling fn for each
+// event in order. The stack and program counter are not part of
+// the trace, and faults are reported with a generic error.
+func ReadBinaryTrace(r io.Reader, fn func(e *TraceEvent) error) error {
+	magic := make([]byte, len(traceMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != traceMagic {
+		return ErrInvalidTrace
+	}
+
+	var prev Registers
+	for {
+		var rec traceRecord
+		err := binary.Read(r, binary.LittleEndian, &rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrInvalidTrace
+		}
+
+		e := TraceEvent{
+			PC:     rec.PC,
+			Opcode: rec.Opcode,
+			Before: prev,
+			After: Registers{
+				V:  rec.V,
+				I:  rec.I,
+				SP: rec.SP,
+				DT: rec.DT,
+				ST: rec.ST,
+			},
+		}
+		e.Before.PC = rec.PC
+
+		b := []byte{byte(rec.Opcode >> 8), byte(rec.Opcode), byte(rec.Next >> 8), byte(rec.Next)}
+		if d, err := disasm.Decode(b); err == nil {
+			e.Mnemonic = d.Mnemonic()
+			e.Text = d.String()
+		}
+		if rec.Faulted != 0 {
+			e.Err = errors.New("Faulted.")
+		}
+
+		if err := fn(&e); err != nil {
+			return err
+		}
+
+		prev = e.After
+	}
+}
@@ -0,0 +1,123 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// v3 := 0x10, i := long 0x0300, then an unknown opcode.
+var traceRom = []byte{0x63, 0x10, 0xf0, 0x00, 0x03, 0x00, 0xff, 0xff}
+
+type recordingTracer struct {
+	events []TraceEvent
+}
+
+func (r *recordingTracer) Trace(e *TraceEvent) {
+	r.events = append(r.events, *e)
+}
+
+func runTraced(t *testing.T, tr Tracer) {
+	t.Helper()
+
+	vm := New(WithPlatform(XOChip), WithTracer(tr))
+	if err := vm.LoadRom(traceRom); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_ = vm.Cycle()
+	}
+}
+
+func TestTracesEachInstruction(t *testing.T) {
+	rec := &recordingTracer{}
+	runTraced(t, rec)
+
+	// A second vm without a tracer must not be traced.
+	other := New()
+	_ = other.LoadRom(traceRom)
+	_ = other.Cycle()
+
+	if len(rec.events) != 3 {
+		t.Fatalf("got %d events", len(rec.events))
+	}
+
+	e := rec.events[0]
+	if e.PC != 0x200 || e.Opcode != 0x6310 || e.Mnemonic != "LD" || e.Text != "v3 := 0x10" ||
+		e.Before.V[3] != 0 || e.After.V[3] != 0x10 || e.Err != nil {
+		t.Fatalf("got %+v", e)
+	}
+
+	if rec.events[1].Text != "i := long 0x300" || rec.events[2].Err == nil {
+		t.Fatalf("got %+v", rec.events[1:])
+	}
+}
+
+func TestTextTracer(t *testing.T) {
+	var buf bytes.Buffer
+	runTraced(t, NewTextTracer(&buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "0200 6310 LD") ||
+		!strings.HasSuffix(lines[0], "V3=10") || !strings.Contains(lines[2], "!") {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var buf bytes.Buffer
+	runTraced(t, NewJSONTracer(&buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+
+	var e struct {
+		PC    uint16
+		Text  string
+		After Registers
+		Error string
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.PC != 0x202 || e.Text != "i := long 0x300" || e.After.I != 0x300 || e.Error != "" {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestBinaryTracerRoundTrips(t *testing.T) {
+	rec := &recordingTracer{}
+	runTraced(t, rec)
+
+	var buf bytes.Buffer
+	runTraced(t, NewBinaryTracer(&buf))
+
+	if buf.Len() != len(traceMagic)+3*28 {
+		t.Fatalf("got %d bytes", buf.Len())
+	}
+
+	var got []TraceEvent
+	err := ReadBinaryTrace(&buf, func(e *TraceEvent) error {
+		got = append(got, *e)
+		return nil
+	})
+	if err != nil || len(got) != 3 {
+		t.Fatalf("got %d events, %v", len(got), err)
+	}
+
+	for i, e := range got {
+		want := rec.events[i]
+		if e.PC != want.PC || e.Opcode != want.Opcode || e.Text != want.Text ||
+			e.After.V != want.After.V || e.After.I != want.After.I || (e.Err != nil) != (want.Err != nil) {
+			t.Errorf("event %d: got %+v, want %+v", i, e, want)
+		}
+	}
+
+	if ReadBinaryTrace(strings.NewReader("nope"), nil) != ErrInvalidTrace {
+		t.Fail()
+	}
+}
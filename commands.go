@@ -0,0 +1,291 @@
+// Subcommands that work on ROMs without opening a window.
+//
+//	gochip disasm [-o out.8o] rom.ch8
+//	gochip asm [-o out.ch8] [-sym out.sym] in.8o
+//	gochip run -headless [-frames n] [-keys script] [-format png] [-o out.png] rom.ch8
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oliveira-a/gochip/chip8"
+	"github.com/oliveira-a/gochip/chip8/asm"
+	"github.com/oliveira-a/gochip/chip8/disasm"
+	"github.com/oliveira-a/gochip/headless"
+	"github.com/oliveira-a/gochip/romdb"
+)
+
+// Runs the subcommand named by the first argument. Reports false
+// if there is no such subcommand.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "disasm":
+		return true, disasmCommand(args[1:])
+	case "asm":
+		return true, asmCommand(args[1:])
+	case "run":
+		return true, runRomCommand(args[1:])
+	default:
+		return false, nil
+	}
+}
+
+func disasmCommand(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	out := fs.String("o", "", "Write the Octo source to this file instead of stdout.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gochip disasm [-o out.8o] rom.ch8")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("Expected a single ROM file.")
+	}
+
+	rom, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	fmt.Fprintf(w, "# %s disassembled by gochip\n\n", filepath.Base(fs.Arg(0)))
+
+	return disasm.Disassemble(rom, 0x200).WriteOcto(w)
+}
+
+func asmCommand(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "Write the ROM to this file. Defaults to the source name with a .ch8 extension.")
+	sym := fs.String("sym", "", "Write the symbol map to this file. Defaults to the ROM name with a .sym extension.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gochip asm [-o out.ch8] [-sym out.sym] in.8o")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("Expected a single source file.")
+	}
+
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	p, err := asm.Assemble(string(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".ch8"
+	}
+	if *sym == "" {
+		*sym = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".sym"
+	}
+
+	if err := os.WriteFile(*out, p.ROM, 0o644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*sym)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.WriteSymbols(f)
+}
+
+// Runs a ROM without a window or sound and writes out its frames.
+// Exits with an error if the vm faults.
+func runRomCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	headlessMode := fs.Bool("headless", false, "Run without a window or sound. Required for now.")
+	frames := fs.Int("frames", 600, "How many 60 Hz frames to run.")
+	ipf := fs.Int("ipf", 11, "How many instructions to execute per frame.")
+	platform := fs.String("platform", "chip8", "The platform to emulate: chip8, schip or xochip.")
+	quirks := fs.String("quirks", "", "The quirks preset. Defaults to the platform's.")
+	seed := fs.Uint64("seed", 0, "Seed for the CXNN random number generator. Seeded from the clock if not set.")
+	keys := fs.String("keys", "", "A key script of 'frame press|release|tap key' lines.")
+	every := fs.Int("every", 0, "Also write every Nth frame, not just the last.")
+	format := fs.String("format", "png", "The frame format: png, ascii or raw.")
+	scale := fs.Int("scale", 4, "How much to scale up png frames.")
+	out := fs.String("o", "-", "Write frames to this file, or - for stdout. The format's extension is added if there is none, and with -every the frame number.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gochip run -headless [flags] rom.ch8")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if !*headlessMode {
+		return errors.New("Only -headless is supported by gochip run for now.")
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("Expected a single ROM file.")
+	}
+
+	f, err := headless.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	opts, err := vmOptions(fs, *platform, *quirks, *seed)
+	if err != nil {
+		return err
+	}
+
+	rom, err := asm.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	info, err := lookupRom(rom)
+	if err != nil {
+		return err
+	}
+
+	p, q, err := romPlatform(fs, *platform, *quirks, info)
+	if err != nil {
+		return err
+	}
+	if info.TickRate > 0 && !isFlagSet(fs, "ipf") {
+		*ipf = info.TickRate
+	}
+
+	vm := chip8.New(append(opts, chip8.WithPlatform(p), chip8.WithQuirks(q))...)
+	if err := vm.LoadRom(rom); err != nil {
+		return err
+	}
+
+	runOpts := headless.Options{Frames: *frames, IPF: *ipf, Every: *every}
+	if *keys != "" {
+		kf, err := os.Open(*keys)
+		if err != nil {
+			return err
+		}
+		defer kf.Close()
+
+		if runOpts.Script, err = headless.ParseScript(kf); err != nil {
+			return fmt.Errorf("%s: %w", *keys, err)
+		}
+	}
+
+	emit := headless.Writer(f, *scale, func(frame int) (io.Writer, error) {
+		if *out == "-" {
+			return headless.Shared(os.Stdout), nil
+		}
+		// Names without an extension get the format's.
+		ext := filepath.Ext(*out)
+		base := strings.TrimSuffix(*out, ext)
+		if ext == "" {
+			ext = f.Ext()
+		}
+
+		if *every == 0 {
+			return os.Create(base + ext)
+		}
+
+		return os.Create(fmt.Sprintf("%s_%06d%s", base, frame, ext))
+	})
+
+	return headless.Run(vm, runOpts, emit)
+}
+
+// Returns the vm options for the platform and quirks presets
+// named on the command line, seeding the vm only if -seed was set.
+func vmOptions(fs *flag.FlagSet, platform, quirks string, seed uint64) ([]chip8.Option, error) {
+	p, err := chip8.ParsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []chip8.Option{chip8.WithPlatform(p)}
+
+	if quirks != "" {
+		q, err := chip8.ParseQuirks(quirks)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, chip8.WithQuirks(q))
+	}
+
+	if isFlagSet(fs, "seed") {
+		opts = append(opts, chip8.WithSeed(seed))
+	}
+
+	return opts, nil
+}
+
+// Looks a ROM up in the embedded database. The zero Info is
+// returned for unknown ROMs.
+func lookupRom(rom []byte) (romdb.Info, error) {
+	db, err := romdb.Default()
+	if err != nil {
+		return romdb.Info{}, err
+	}
+
+	info, _ := db.Lookup(rom)
+	return info, nil
+}
+
+// Returns the platform and quirks to run a ROM with. Each is taken
+// from the command line if it was given there, then from the
+// database, then from the platform defaults.
+func romPlatform(fs *flag.FlagSet, platform, quirks string, info romdb.Info) (chip8.Platform, chip8.Quirks, error) {
+	p := info.Platform
+	if !info.Supported || isFlagSet(fs, "platform") {
+		var err error
+		if p, err = chip8.ParsePlatform(platform); err != nil {
+			return p, chip8.Quirks{}, err
+		}
+	}
+
+	if quirks != "" {
+		q, err := chip8.ParseQuirks(quirks)
+		return p, q, err
+	}
+
+	// The database's quirks are for its platform.
+	if info.Supported && p == info.Platform {
+		return p, info.Quirks, nil
+	}
+
+	return p, chip8.DefaultQuirks(p), nil
+}
+
+// Reports whether the flag was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
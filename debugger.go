@@ -0,0 +1,401 @@
+// The debugger panel. F9 shows it to the right of the game with
+// the registers, the call stack, a disassembly around the program
+// counter and a hex view of memory. F5 pauses and continues, F10
+// steps an instruction and F11 steps a frame. Clicking a line in
+// the disassembly toggles a breakpoint on it.
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/ebitenui/ebitenui/image"
+	"github.com/ebitenui/ebitenui/widget"
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	text "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/oliveira-a/gochip/chip8"
+	"github.com/oliveira-a/gochip/chip8/disasm"
+)
+
+const (
+	debugPanelWidth  = 340
+	debugPanelHeight = 520
+
+	// How many instructions to show before and after the pc.
+	disasmContext = 6
+
+	// Bytes per line in the memory view.
+	hexLineWidth = 8
+)
+
+var (
+	debugToggleKey   = ebiten.KeyF9
+	debugContinueKey = ebiten.KeyF5
+	debugStepKey     = ebiten.KeyF10
+	debugFrameKey    = ebiten.KeyF11
+)
+
+type debugger struct {
+	visible bool
+	paused  bool
+
+	// Requested by the controls and carried out on the next
+	// update.
+	stepInstruction bool
+	stepFrame       bool
+
+	vm *chip8.VM
+
+	// The ids of the breakpoints set on the vm, by address.
+	breakpoints map[uint16]int
+
+	// Set when the views need rebuilding.
+	dirty bool
+
+	panel       *widget.Container
+	registers   *widget.Text
+	disasm      *widget.List
+	memory      *widget.TextArea
+	pauseButton *widget.Button
+}
+
+// A line in the disassembly view.
+type disasmLine struct {
+	addr  uint16
+	label string
+}
+
+func newDebugger(vm *chip8.VM) *debugger {
+	d := &debugger{
+		vm:          vm,
+		breakpoints: map[uint16]int{},
+		dirty:       true,
+	}
+
+	d.createPanel()
+	d.panel.GetWidget().Visibility = widget.Visibility_Hide
+
+	return d
+}
+
+// Handles the debugger hotkeys.
+func (d *debugger) handleKeys() {
+	if inpututil.IsKeyJustPressed(debugToggleKey) {
+		d.toggle()
+	}
+
+	if !d.visible {
+		return
+	}
+
+	if inpututil.IsKeyJustPressed(debugContinueKey) {
+		d.togglePause()
+	}
+	if inpututil.IsKeyJustPressed(debugStepKey) {
+		d.step(false)
+	}
+	if inpututil.IsKeyJustPressed(debugFrameKey) {
+		d.step(true)
+	}
+}
+
+func (d *debugger) toggle() {
+	d.visible = !d.visible
+	d.dirty = true
+
+	if d.visible {
+		d.panel.GetWidget().Visibility = widget.Visibility_Show
+		ebiten.SetWindowSize(winWidth+romListWidth+debugPanelWidth, max(winHeight, debugPanelHeight))
+	} else {
+		d.panel.GetWidget().Visibility = widget.Visibility_Hide
+		ebiten.SetWindowSize(winWidth+romListWidth, winHeight)
+	}
+}
+
+func (d *debugger) togglePause() {
+	d.paused = !d.paused
+	d.dirty = true
+}
+
+func (d *debugger) pause() {
+	d.paused = true
+	d.dirty = true
+}
+
+// Pauses the vm, then steps it by one instruction or one frame on
+// the next update.
+func (d *debugger) step(frame bool) {
+	d.pause()
+
+	if frame {
+		d.stepFrame = true
+	} else {
+		d.stepInstruction = true
+	}
+}
+
+// Reports whether the debugger has to drive the vm, rather than
+// letting it run whole frames on its own.
+func (d *debugger) active() bool {
+	return d.paused || len(d.breakpoints) > 0
+}
+
+// Runs a frame under the debugger, stopping at breakpoints.
+// Reports whether the vm ran at all, so paused frames are not
+// recorded for rewinding.
+func (d *debugger) runFrame(vm *chip8.VM, ipf int) (bool, error) {
+	switch {
+	case d.paused && d.stepInstruction:
+		d.stepInstruction = false
+		d.dirty = true
+		return true, vm.Cycle()
+	case d.paused && d.stepFrame:
+		d.stepFrame = false
+		d.dirty = true
+		return true, vm.RunFrame(ipf)
+	case d.paused:
+		return false, nil
+	}
+
+	switch r := vm.RunUntilBreak(ipf); r.Kind {
+	case chip8.StopBreakpoint:
+		d.pause()
+	case chip8.StopFault:
+		return true, r.Err
+	}
+
+	vm.TickTimers()
+
+	return true, nil
+}
+
+// Rebuilds the views from the vm. While the vm is running only
+// the registers are kept live, since rebuilding the disassembly
+// and memory views every frame is slow.
+func (d *debugger) refresh(vm *chip8.VM) {
+	if !d.visible {
+		return
+	}
+
+	r := vm.Registers()
+	d.registers.Label = formatRegisters(r)
+
+	if d.paused {
+		d.pauseButton.Text().Label = "Continue"
+	} else {
+		d.pauseButton.Text().Label = "Pause"
+	}
+
+	if !d.dirty {
+		return
+	}
+	d.dirty = false
+
+	var lines []any
+	start := r.PC - disasmContext*2
+	if start > r.PC {
+		start = 0
+	}
+	for addr := start; addr <= r.PC+disasmContext*2; {
+		ins, err := disasm.Decode(vm.ReadMemory(addr, 4))
+		if err != nil {
+			break
+		}
+
+		lines = append(lines, disasmLine{
+			addr:  addr,
+			label: d.formatLine(addr, ins, r.PC),
+		})
+		addr += uint16(ins.Len)
+	}
+	d.disasm.SetEntries(lines)
+
+	if d.paused {
+		d.memory.SetText(formatMemory(vm.ReadMemory(0, vm.Platform().MemorySize())))
+	} else {
+		d.memory.SetText("Pause to view memory.")
+	}
+}
+
+func (d *debugger) toggleBreakpoint(addr uint16) {
+	if id, ok := d.breakpoints[addr]; ok {
+		d.vm.RemoveBreakpoint(id)
+		delete(d.breakpoints, addr)
+	} else {
+		d.breakpoints[addr] = d.vm.AddBreakpoint(chip8.Breakpoint{Addr: addr})
+	}
+
+	d.dirty = true
+}
+
+func (d *debugger) formatLine(addr uint16, ins disasm.Instruction, pc uint16) string {
+	marker := " "
+	if addr == pc {
+		marker = ">"
+	}
+
+	bp := " "
+	if _, ok := d.breakpoints[addr]; ok {
+		bp = "*"
+	}
+
+	return fmt.Sprintf("%s%s%04x %04x %s", marker, bp, addr, ins.Opcode, ins)
+}
+
+func formatRegisters(r chip8.Registers) string {
+	var sb strings.Builder
+
+	for i, v := range r.V {
+		fmt.Fprintf(&sb, "V%X %02x", i, v)
+		if i%4 == 3 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString("  ")
+		}
+	}
+
+	fmt.Fprintf(&sb, "I  %04x  PC %04x\n", r.I, r.PC)
+	fmt.Fprintf(&sb, "DT %02x    ST %02x\n", r.DT, r.ST)
+	fmt.Fprintf(&sb, "SP %x   ", r.SP)
+	for i := 0; i < int(r.SP); i++ {
+		fmt.Fprintf(&sb, " %04x", r.Stack[i])
+	}
+
+	return sb.String()
+}
+
+func formatMemory(mem []byte) string {
+	var sb strings.Builder
+
+	for addr := 0; addr < len(mem); addr += hexLineWidth {
+		fmt.Fprintf(&sb, "%04x", addr)
+		for i := addr; i < addr+hexLineWidth && i < len(mem); i++ {
+			fmt.Fprintf(&sb, " %02x", mem[i])
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func (d *debugger) createPanel() {
+	face, _ := loadFont(8, font)
+	b, _ := loadListItemButtonImage()
+	black := image.NewNineSliceColor(color.NRGBA{0, 0, 0, 255})
+	panelColor := image.NewNineSliceColor(color.NRGBA{30, 30, 30, 255})
+	fg := color.NRGBA{254, 255, 255, 255}
+
+	d.panel = widget.NewContainer(
+		widget.ContainerOpts.BackgroundImage(panelColor),
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+			widget.RowLayoutOpts.Padding(widget.NewInsetsSimple(5)),
+			widget.RowLayoutOpts.Spacing(5),
+		)),
+		widget.ContainerOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(debugPanelWidth, debugPanelHeight),
+			widget.WidgetOpts.LayoutData(widget.AnchorLayoutData{
+				HorizontalPosition: widget.AnchorLayoutPositionEnd,
+				VerticalPosition:   widget.AnchorLayoutPositionStart,
+			}),
+		),
+	)
+
+	d.registers = widget.NewText(
+		widget.TextOpts.Text("", face, fg),
+		widget.TextOpts.WidgetOpts(widget.WidgetOpts.MinSize(debugPanelWidth-10, 70)),
+	)
+	d.panel.AddChild(d.registers)
+
+	controls := widget.NewContainer(
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionHorizontal),
+			widget.RowLayoutOpts.Spacing(5),
+		)),
+	)
+	d.pauseButton = newDebugButton("Pause", face, d.togglePause)
+	controls.AddChild(d.pauseButton)
+	controls.AddChild(newDebugButton("Step", face, func() { d.step(false) }))
+	controls.AddChild(newDebugButton("Frame", face, func() { d.step(true) }))
+	d.panel.AddChild(controls)
+
+	d.disasm = widget.NewList(
+		widget.ListOpts.ContainerOpts(widget.ContainerOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(debugPanelWidth-10, 190),
+		)),
+		widget.ListOpts.ScrollContainerOpts(
+			widget.ScrollContainerOpts.Image(&widget.ScrollContainerImage{
+				Idle:     black,
+				Disabled: black,
+				Mask:     black,
+			}),
+		),
+		widget.ListOpts.SliderOpts(
+			widget.SliderOpts.Images(&widget.SliderTrackImage{Idle: black, Hover: black}, b),
+			widget.SliderOpts.MinHandleSize(5),
+		),
+		widget.ListOpts.HideHorizontalSlider(),
+		widget.ListOpts.AllowReselect(),
+		widget.ListOpts.EntryFontFace(face),
+		widget.ListOpts.EntryTextPadding(widget.NewInsetsSimple(3)),
+		widget.ListOpts.EntryColor(&widget.ListEntryColor{
+			Selected:                   fg,
+			Unselected:                 fg,
+			SelectedBackground:         color.NRGBA{0, 0, 0, 255},
+			SelectingBackground:        color.NRGBA{130, 130, 130, 255},
+			SelectingFocusedBackground: color.NRGBA{130, 130, 130, 255},
+			SelectedFocusedBackground:  color.NRGBA{60, 60, 60, 255},
+			FocusedBackground:          color.NRGBA{60, 60, 60, 255},
+			DisabledUnselected:         color.NRGBA{100, 100, 100, 255},
+			DisabledSelected:           color.NRGBA{100, 100, 100, 255},
+			DisabledSelectedBackground: color.NRGBA{0, 0, 0, 255},
+		}),
+		widget.ListOpts.EntryLabelFunc(func(e any) string {
+			return e.(disasmLine).label
+		}),
+		widget.ListOpts.EntrySelectedHandler(func(args *widget.ListEntrySelectedEventArgs) {
+			d.toggleBreakpoint(args.Entry.(disasmLine).addr)
+		}),
+	)
+	d.panel.AddChild(d.disasm)
+
+	d.memory = widget.NewTextArea(
+		widget.TextAreaOpts.ContainerOpts(widget.ContainerOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(debugPanelWidth-10, 200),
+		)),
+		widget.TextAreaOpts.ScrollContainerOpts(
+			widget.ScrollContainerOpts.Image(&widget.ScrollContainerImage{
+				Idle: black,
+				Mask: black,
+			}),
+		),
+		widget.TextAreaOpts.SliderOpts(
+			widget.SliderOpts.Images(&widget.SliderTrackImage{Idle: black, Hover: black}, b),
+			widget.SliderOpts.MinHandleSize(5),
+		),
+		widget.TextAreaOpts.ShowVerticalScrollbar(),
+		widget.TextAreaOpts.FontFace(face),
+		widget.TextAreaOpts.FontColor(fg),
+		widget.TextAreaOpts.TextPadding(widget.NewInsetsSimple(3)),
+	)
+	d.panel.AddChild(d.memory)
+}
+
+func newDebugButton(label string, face text.Face, clicked func()) *widget.Button {
+	btnImg, _ := loadContextMenuButtonImage()
+
+	return widget.NewButton(
+		widget.ButtonOpts.Image(btnImg),
+		widget.ButtonOpts.Text(label, face, &widget.ButtonTextColor{
+			Idle:  color.NRGBA{0, 0, 0, 255},
+			Hover: color.NRGBA{255, 255, 255, 255},
+		}),
+		widget.ButtonOpts.TextPadding(widget.NewInsetsSimple(5)),
+		widget.ButtonOpts.ClickedHandler(func(args *widget.ButtonClickedEventArgs) {
+			clicked()
+		}),
+	)
+}
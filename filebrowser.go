@@ -0,0 +1,223 @@
+// The file browser for opening ROMs from disk. It lists the
+// directories and ROM files in a directory. Clicking a directory
+// opens it and clicking a ROM loads it, along with the rest of
+// the directory, into the ROM list. The directory shown can also
+// be added to the ROM library.
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/ebitenui/ebitenui"
+	eimage "github.com/ebitenui/ebitenui/image"
+	"github.com/ebitenui/ebitenui/widget"
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/oliveira-a/gochip/library"
+)
+
+const (
+	browserWidth  = 480
+	browserHeight = 300
+)
+
+// A line in the file browser.
+type browserEntry struct {
+	name string
+	dir  bool
+}
+
+type fileBrowser struct {
+	// The directory being shown.
+	dir string
+
+	window *widget.Window
+	title  *widget.Text
+	list   *widget.List
+
+	// Called with the ROMs in the directory and the one picked.
+	open func(items []*listItem, picked int)
+
+	// Called with the directory to add it to the library.
+	addDir func(dir string)
+}
+
+func newFileBrowser(open func(items []*listItem, picked int), addDir func(dir string)) *fileBrowser {
+	b := &fileBrowser{open: open, addDir: addDir}
+
+	if wd, err := os.Getwd(); err == nil {
+		b.dir = wd
+	}
+
+	b.createWindow()
+
+	return b
+}
+
+// Opens the browser on Ctrl+O.
+func (g *Game) handleOpenKey() {
+	if ebiten.IsKeyPressed(ebiten.KeyControl) && inpututil.IsKeyJustPressed(ebiten.KeyO) {
+		g.browser.show(g.ui)
+	}
+}
+
+// Shows the browser over the game, listing its directory afresh.
+func (b *fileBrowser) show(ui *ebitenui.UI) {
+	if ui.IsWindowOpen(b.window) {
+		return
+	}
+
+	b.chdir(b.dir)
+
+	x := romListWidth + (winWidth-browserWidth)/2
+	y := (winHeight - browserHeight) / 2
+	b.window.SetLocation(image.Rect(x, y, x+browserWidth, y+browserHeight))
+	ui.AddWindow(b.window)
+}
+
+// Lists dir, keeping the current directory if it cannot be read.
+func (b *fileBrowser) chdir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		b.title.Label = err.Error()
+		return
+	}
+
+	b.dir = dir
+	b.title.Label = dir
+
+	var found []browserEntry
+	for _, e := range entries {
+		if e.IsDir() || library.IsRom(e.Name()) {
+			found = append(found, browserEntry{name: e.Name(), dir: e.IsDir()})
+		}
+	}
+
+	// Directories first, then by name.
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dir != found[j].dir {
+			return found[i].dir
+		}
+		return found[i].name < found[j].name
+	})
+
+	items := []any{browserEntry{name: "..", dir: true}}
+	for _, e := range found {
+		items = append(items, e)
+	}
+	b.list.SetEntries(items)
+}
+
+func (b *fileBrowser) selected(e browserEntry) {
+	if e.dir {
+		b.chdir(filepath.Clean(filepath.Join(b.dir, e.name)))
+		return
+	}
+
+	items, err := diskRomItems(b.dir)
+	if err != nil {
+		b.title.Label = err.Error()
+		return
+	}
+
+	picked := slices.IndexFunc(items, func(li *listItem) bool {
+		return filepath.Base(li.path) == e.name
+	})
+
+	b.window.Close()
+	b.open(items, max(picked, 0))
+}
+
+func (b *fileBrowser) createWindow() {
+	face, _ := loadFont(8, font)
+	btn, _ := loadListItemButtonImage()
+	black := eimage.NewNineSliceColor(color.NRGBA{0, 0, 0, 255})
+	panelColor := eimage.NewNineSliceColor(color.NRGBA{30, 30, 30, 255})
+	fg := color.NRGBA{254, 255, 255, 255}
+
+	contents := widget.NewContainer(
+		widget.ContainerOpts.BackgroundImage(panelColor),
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+			widget.RowLayoutOpts.Padding(widget.NewInsetsSimple(5)),
+			widget.RowLayoutOpts.Spacing(5),
+		)),
+	)
+
+	b.title = widget.NewText(
+		widget.TextOpts.Text("", face, fg),
+		widget.TextOpts.WidgetOpts(widget.WidgetOpts.MinSize(browserWidth-10, 12)),
+	)
+	contents.AddChild(b.title)
+
+	b.list = widget.NewList(
+		widget.ListOpts.ContainerOpts(widget.ContainerOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(browserWidth-10, browserHeight-60),
+		)),
+		widget.ListOpts.ScrollContainerOpts(
+			widget.ScrollContainerOpts.Image(&widget.ScrollContainerImage{
+				Idle:     black,
+				Disabled: black,
+				Mask:     black,
+			}),
+		),
+		widget.ListOpts.SliderOpts(
+			widget.SliderOpts.Images(&widget.SliderTrackImage{Idle: black, Hover: black}, btn),
+			widget.SliderOpts.MinHandleSize(5),
+		),
+		widget.ListOpts.HideHorizontalSlider(),
+		widget.ListOpts.AllowReselect(),
+		widget.ListOpts.EntryFontFace(face),
+		widget.ListOpts.EntryTextPadding(widget.NewInsetsSimple(3)),
+		widget.ListOpts.EntryColor(&widget.ListEntryColor{
+			Selected:                   fg,
+			Unselected:                 fg,
+			SelectedBackground:         color.NRGBA{0, 0, 0, 255},
+			SelectingBackground:        color.NRGBA{130, 130, 130, 255},
+			SelectingFocusedBackground: color.NRGBA{130, 130, 130, 255},
+			SelectedFocusedBackground:  color.NRGBA{60, 60, 60, 255},
+			FocusedBackground:          color.NRGBA{60, 60, 60, 255},
+			DisabledUnselected:         color.NRGBA{100, 100, 100, 255},
+			DisabledSelected:           color.NRGBA{100, 100, 100, 255},
+			DisabledSelectedBackground: color.NRGBA{0, 0, 0, 255},
+		}),
+		widget.ListOpts.EntryLabelFunc(func(e any) string {
+			if e := e.(browserEntry); e.dir {
+				return e.name + "/"
+			}
+			return e.(browserEntry).name
+		}),
+		widget.ListOpts.EntrySelectedHandler(func(args *widget.ListEntrySelectedEventArgs) {
+			b.selected(args.Entry.(browserEntry))
+		}),
+	)
+	contents.AddChild(b.list)
+
+	buttons := widget.NewContainer(
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionHorizontal),
+			widget.RowLayoutOpts.Spacing(5),
+		)),
+	)
+	buttons.AddChild(newDebugButton("Add to library", face, func() {
+		b.window.Close()
+		b.addDir(b.dir)
+	}))
+	buttons.AddChild(newDebugButton("Cancel", face, func() {
+		b.window.Close()
+	}))
+	contents.AddChild(buttons)
+
+	b.window = widget.NewWindow(
+		widget.WindowOpts.Contents(contents),
+		widget.WindowOpts.Modal(),
+		widget.WindowOpts.CloseMode(widget.CLICK_OUT),
+		widget.WindowOpts.MinSize(browserWidth, browserHeight),
+	)
+}
@@ -0,0 +1,167 @@
+// Gamepads. Pads with Ebiten's standard layout are read as a set
+// of actions, the D-pad or left stick for the directions and the
+// face buttons for "a" and "b", which are mapped to hex keys. Up
+// to two pads are used, in the order they were connected, and the
+// second one's actions are named after the ROM database's, as in
+// "player2Up". Both feed the same keypad.
+//
+// The mapping is the default below with the "gamepad" overrides
+// in keymap.json applied, or the ROM database's keys for the ROM
+// if it has any, and then the ROM's own overrides under
+// "romGamepads".
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+const (
+	maxGamepads = 2
+
+	// How far a stick has to be pushed to count as a direction.
+	stickThreshold = 0.5
+)
+
+// The hex key for each action.
+type padmap map[string]chip8.Key
+
+// The keys most Octo games use, with W A S D for the directions
+// and E and Q for the buttons. The second player has no keys
+// unless the ROM or keymap.json has some.
+var defaultPadmap = padmap{
+	"up":    0x5,
+	"down":  0x8,
+	"left":  0x7,
+	"right": 0x9,
+	"a":     0x6,
+	"b":     0x4,
+}
+
+// The buttons and stick directions read as each action.
+var padActions = []struct {
+	name    string
+	buttons []ebiten.StandardGamepadButton
+	axis    ebiten.StandardGamepadAxis
+	sign    float64
+}{
+	{"up", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftTop}, ebiten.StandardGamepadAxisLeftStickVertical, -1},
+	{"down", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftBottom}, ebiten.StandardGamepadAxisLeftStickVertical, 1},
+	{"left", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftLeft}, ebiten.StandardGamepadAxisLeftStickHorizontal, -1},
+	{"right", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftRight}, ebiten.StandardGamepadAxisLeftStickHorizontal, 1},
+	{"a", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightBottom, ebiten.StandardGamepadButtonRightLeft}, 0, 0},
+	{"b", []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight, ebiten.StandardGamepadButtonRightTop}, 0, 0},
+}
+
+// Returns the name of an action for the given player, counting
+// from 0.
+func playerAction(player int, action string) string {
+	if player == 0 {
+		return action
+	}
+
+	return fmt.Sprintf("player%d%s%s", player+1, strings.ToUpper(action[:1]), action[1:])
+}
+
+// Sets the keys in m, which maps actions to hex digits.
+func (pm padmap) apply(m map[string]string) error {
+	for action, digit := range m {
+		k, err := hexKey(digit)
+		if err != nil {
+			return err
+		}
+		pm[action] = k
+	}
+
+	return nil
+}
+
+// Returns the hex keys pressed on the connected pads, one bit per
+// key.
+func (g *Game) gamepadKeys() uint16 {
+	var keys uint16
+
+	for player, id := range g.gamepads {
+		for _, a := range padActions {
+			k, ok := g.padmap[playerAction(player, a.name)]
+			if !ok || !padActionPressed(id, a.buttons, a.axis, a.sign) {
+				continue
+			}
+			keys |= 1 << k
+		}
+	}
+
+	return keys
+}
+
+func padActionPressed(id ebiten.GamepadID, buttons []ebiten.StandardGamepadButton, axis ebiten.StandardGamepadAxis, sign float64) bool {
+	for _, b := range buttons {
+		if ebiten.IsStandardGamepadButtonPressed(id, b) {
+			return true
+		}
+	}
+
+	return sign != 0 && ebiten.StandardGamepadAxisValue(id, axis)*sign > stickThreshold
+}
+
+// Keeps up to two pads with the standard layout, dropping the
+// disconnected ones and taking on new ones as they are plugged in.
+func (g *Game) handleGamepads() {
+	for i := 0; i < len(g.gamepads); {
+		if !inpututil.IsGamepadJustDisconnected(g.gamepads[i]) {
+			i++
+			continue
+		}
+
+		g.gamepads = slices.Delete(g.gamepads, i, i+1)
+		g.notify(fmt.Sprintf("Gamepad %d disconnected", i+1))
+	}
+
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if len(g.gamepads) == maxGamepads {
+			break
+		}
+		if slices.Contains(g.gamepads, id) || !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+
+		g.gamepads = append(g.gamepads, id)
+		g.notify(fmt.Sprintf("Gamepad %d: %s", len(g.gamepads), ebiten.GamepadName(id)))
+	}
+}
+
+// Returns the pad mapping for the ROM with the given hash, with
+// the ROM database's keys for it.
+func (c *keymapConfig) padmapForRom(hash string, preset map[string]chip8.Key) (padmap, error) {
+	pm := padmap{}
+	for action, k := range defaultPadmap {
+		pm[action] = k
+	}
+
+	if err := pm.apply(c.Gamepad); err != nil {
+		return defaultPadmap, err
+	}
+
+	// The ROM's other keys may be in use, so its keys replace the
+	// defaults rather than add to them.
+	if len(preset) > 0 {
+		pm = padmap{}
+		for action, k := range preset {
+			pm[action] = k
+		}
+	}
+
+	if hash != "" {
+		if err := pm.apply(c.RomGamepads[hash]); err != nil {
+			return defaultPadmap, err
+		}
+	}
+
+	return pm, nil
+}
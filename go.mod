@@ -6,7 +6,6 @@ require (
 	github.com/ebitengine/oto/v3 v3.2.0
 	github.com/ebitenui/ebitenui v0.6.0
 	github.com/hajimehoshi/ebiten/v2 v2.7.8
-	github.com/hajimehoshi/go-mp3 v0.3.4
 )
 
 require (
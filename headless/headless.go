@@ -0,0 +1,89 @@
+// Package headless runs a vm without a window or audio, for tests
+// and CI. It drives chip8.VM directly, feeds it a scripted key
+// sequence and renders frames as PNG, ASCII art or raw bitmaps.
+package headless
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+// Configures Run.
+type Options struct {
+	// How many 60 Hz frames to run.
+	Frames int
+
+	// Instructions executed per frame.
+	IPF int
+
+	// Key presses and releases to feed the vm, may be nil.
+	Script Script
+
+	// Emit every Nth frame as well as the last. Zero only emits
+	// the last one.
+	Every int
+}
+
+// Receives the frames Run emits, numbered from 1.
+type EmitFunc func(frame int, vm *chip8.VM) error
+
+// Runs the vm for opts.Frames frames, or until the program exits,
+// calling emit for every opts.Every-th frame and for the last one.
+// Returns the fault that stopped the vm, if any.
+func Run(vm *chip8.VM, opts Options, emit EmitFunc) error {
+	if opts.IPF < 1 {
+		return fmt.Errorf("Invalid instructions per frame %d.", opts.IPF)
+	}
+
+	for frame := 1; frame <= opts.Frames; frame++ {
+		opts.Script.apply(frame, &vm.Keypad)
+
+		if err := vm.RunFrame(opts.IPF); err != nil {
+			return err
+		}
+
+		last := frame == opts.Frames || vm.Exited()
+		if last || opts.Every > 0 && frame%opts.Every == 0 {
+			if err := emit(frame, vm); err != nil {
+				return err
+			}
+		}
+
+		if last {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Returns an EmitFunc writing each frame in format to the writer
+// open returns for it. The writer is closed afterwards if it is an
+// io.Closer, so a writer shared by every frame, such as os.Stdout,
+// has to be wrapped with Shared.
+func Writer(format Format, scale int, open func(frame int) (io.Writer, error)) EmitFunc {
+	return func(frame int, vm *chip8.VM) error {
+		w, err := open(frame)
+		if err != nil {
+			return err
+		}
+
+		err = format.write(w, vm, scale)
+
+		if c, ok := w.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+
+		return err
+	}
+}
+
+// Returns w without its Close method, for a writer open returns
+// for every frame and Writer must leave open.
+func Shared(w io.Writer) io.Writer {
+	return struct{ io.Writer }{w}
+}
@@ -0,0 +1,151 @@
+package headless
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+// Waits for a key and draws its hex digit at the top left.
+var keyRom = []byte{
+	0x60, 0x00, // v0 := 0
+	0xf1, 0x0a, // v1 := key
+	0xf1, 0x29, // i := hex v1
+	0xd0, 0x05, // sprite v0 v0 5
+	0x12, 0x08, // jump 0x208
+}
+
+func newVM(t *testing.T, rom []byte) *chip8.VM {
+	t.Helper()
+
+	vm := chip8.New(chip8.WithSeed(1))
+	if err := vm.LoadRom(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	return vm
+}
+
+func TestRunsScriptAndRendersASCII(t *testing.T) {
+	script, err := ParseScript(strings.NewReader("# tap A\n2 tap a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	emit := Writer(FormatASCII, 1, func(int) (io.Writer, error) { return &out, nil })
+
+	err = Run(newVM(t, keyRom), Options{Frames: 5, IPF: 10, Script: script}, emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(out.String(), "\n")
+	want := []string{"####", "#..#", "####", "#..#", "#..#"}
+	for i, w := range want {
+		if !strings.HasPrefix(rows[i], w+"....") {
+			t.Fatalf("row %d: got %q", i, rows[i])
+		}
+	}
+	if len(rows[0]) != chip8.Cols || len(rows) != chip8.Rows+1 {
+		t.Fatalf("got %d rows of %d", len(rows), len(rows[0]))
+	}
+}
+
+func TestEmitsEveryNthAndLastFrame(t *testing.T) {
+	var frames []int
+	err := Run(newVM(t, keyRom), Options{Frames: 5, IPF: 1, Every: 2}, func(frame int, _ *chip8.VM) error {
+		frames = append(frames, frame)
+		return nil
+	})
+
+	if err != nil || len(frames) != 3 || frames[0] != 2 || frames[1] != 4 || frames[2] != 5 {
+		t.Fatalf("got %v %v", frames, err)
+	}
+}
+
+// Fails writes once closed, like a file.
+type closingWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *closingWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write after close")
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *closingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestEmitsFramesToSharedWriter(t *testing.T) {
+	var out closingWriter
+	emit := Writer(FormatASCII, 1, func(int) (io.Writer, error) { return Shared(&out), nil })
+
+	if err := Run(newVM(t, keyRom), Options{Frames: 4, IPF: 1, Every: 1}, emit); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.closed || strings.Count(out.String(), "\n") != 4*chip8.Rows {
+		t.Fatalf("closed %v after %d rows", out.closed, strings.Count(out.String(), "\n"))
+	}
+
+	// Writers of their own are still closed.
+	var own closingWriter
+	emit = Writer(FormatASCII, 1, func(int) (io.Writer, error) { return &own, nil })
+	if err := emit(1, newVM(t, keyRom)); err != nil || !own.closed {
+		t.Fatalf("got %v, closed %v", err, own.closed)
+	}
+}
+
+func TestReturnsFaults(t *testing.T) {
+	err := Run(newVM(t, []byte{0x00, 0xee}), Options{Frames: 5, IPF: 1}, nil)
+	if !errors.Is(err, chip8.ErrStackUnderflow) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWritesScaledPNGAndRaw(t *testing.T) {
+	// Draws a single pixel at (1, 0).
+	vm := newVM(t, []byte{0xa2, 0x04, 0xd0, 0x01, 0x40})
+	_ = vm.Cycle()
+	_ = vm.Cycle()
+
+	var buf bytes.Buffer
+	if err := FormatPNG.write(&buf, vm, 4); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != chip8.Cols*4 || b.Dy() != chip8.Rows*4 {
+		t.Fatalf("got %v", b)
+	}
+	if r, _, _, _ := img.At(5, 3).RGBA(); r != 0xffff {
+		t.Fail()
+	}
+
+	buf.Reset()
+	_ = WriteRaw(&buf, vm)
+	if buf.Len() != chip8.Cols*chip8.Rows || buf.Bytes()[1] != 1 {
+		t.Fail()
+	}
+}
+
+func TestRejectsBadScripts(t *testing.T) {
+	for _, s := range []string{"1 press", "x press 1", "1 hold 1", "1 press g"} {
+		if _, err := ParseScript(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
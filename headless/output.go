@@ -0,0 +1,135 @@
+package headless
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+// How frames are written.
+type Format uint8
+
+const (
+	// A PNG image, scaled up by a whole factor.
+	FormatPNG Format = iota
+
+	// A line of text per row: '.' for unlit pixels, '#' for the
+	// first plane, '+' for the second and '@' for both.
+	FormatASCII
+
+	// One byte per pixel holding its plane bits, row by row,
+	// with no header. The size follows from vm.Resolution.
+	FormatRaw
+)
+
+var ErrUnknownFormat = errors.New("Unknown output format, expected png, ascii or raw.")
+
+// The colours for pixels lit on no plane, the first, the second
+// and both, matching the frontend.
+var Palette = color.Palette{
+	color.Black,
+	color.White,
+	color.RGBA{0xaa, 0xaa, 0xaa, 0xff},
+	color.RGBA{0x55, 0x55, 0x55, 0xff},
+}
+
+var asciiPixels = [4]byte{'.', '#', '+', '@'}
+
+// Returns the format named png, ascii or raw.
+func ParseFormat(s string) (Format, error) {
+	for f := FormatPNG; f <= FormatRaw; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+
+	return 0, ErrUnknownFormat
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatASCII:
+		return "ascii"
+	case FormatRaw:
+		return "raw"
+	default:
+		return "png"
+	}
+}
+
+// Returns the usual file extension for the format.
+func (f Format) Ext() string {
+	switch f {
+	case FormatASCII:
+		return ".txt"
+	case FormatRaw:
+		return ".raw"
+	default:
+		return ".png"
+	}
+}
+
+func (f Format) write(w io.Writer, vm *chip8.VM, scale int) error {
+	switch f {
+	case FormatASCII:
+		return WriteASCII(w, vm)
+	case FormatRaw:
+		return WriteRaw(w, vm)
+	default:
+		return png.Encode(w, Image(vm, scale))
+	}
+}
+
+// Returns the display as an image, each pixel scaled up to a
+// scale by scale square.
+func Image(vm *chip8.VM, scale int) *image.Paletted {
+	scale = max(scale, 1)
+	f := vm.Frame()
+	cols, rows := f.Size()
+
+	img := image.NewPaletted(image.Rect(0, 0, cols*scale, rows*scale), Palette)
+	for y := 0; y < rows*scale; y++ {
+		for x := 0; x < cols*scale; x++ {
+			img.SetColorIndex(x, y, f.Pixel(x/scale, y/scale))
+		}
+	}
+
+	return img
+}
+
+// Writes the display as ASCII art.
+func WriteASCII(w io.Writer, vm *chip8.VM) error {
+	bw := bufio.NewWriter(w)
+	f := vm.Frame()
+	cols, rows := f.Size()
+
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			bw.WriteByte(asciiPixels[f.Pixel(x, y)])
+		}
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// Writes the display as a raw bitmap.
+func WriteRaw(w io.Writer, vm *chip8.VM) error {
+	f := vm.Frame()
+	cols, rows := f.Size()
+
+	b := make([]byte, 0, cols*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			b = append(b, f.Pixel(x, y))
+		}
+	}
+
+	_, err := w.Write(b)
+	return err
+}
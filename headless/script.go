@@ -0,0 +1,102 @@
+package headless
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+// A key sequence to feed the vm, one event per line:
+//
+//	# frame action key
+//	10 press 5
+//	20 release 5
+//	30 tap a
+//
+// Events are queued before their frame runs. A tap is a press and
+// a release in the same frame, which the keypad still spreads over
+// two instructions. Keys are hex digits.
+type Script []ScriptEvent
+
+type ScriptEvent struct {
+	Frame int
+	Key   chip8.Key
+
+	// Whether the key goes down, up, or both.
+	Press   bool
+	Release bool
+}
+
+// Parses a key script, returning the events sorted by frame.
+func ParseScript(r io.Reader) (Script, error) {
+	var s Script
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Line %d: Expected 'frame action key'.", line)
+		}
+
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil || frame < 1 {
+			return nil, fmt.Errorf("Line %d: Invalid frame %q.", line, fields[0])
+		}
+
+		key, err := strconv.ParseUint(fields[2], 16, 4)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: Invalid key %q.", line, fields[2])
+		}
+
+		e := ScriptEvent{Frame: frame, Key: chip8.Key(key)}
+		switch fields[1] {
+		case "press":
+			e.Press = true
+		case "release":
+			e.Release = true
+		case "tap":
+			e.Press, e.Release = true, true
+		default:
+			return nil, fmt.Errorf("Line %d: Unknown action %q.", line, fields[1])
+		}
+
+		s = append(s, e)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Frame < s[j].Frame })
+
+	return s, nil
+}
+
+// Queues the events for the given frame.
+func (s Script) apply(frame int, kp *chip8.Keypad) {
+	for _, e := range s {
+		if e.Frame != frame {
+			continue
+		}
+
+		if e.Press {
+			kp.Press(e.Key)
+		}
+		if e.Release {
+			kp.Release(e.Key)
+		}
+	}
+}
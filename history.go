@@ -0,0 +1,53 @@
+// Hold-to-rewind. Every frame the vm state is pushed into a
+// bounded rewind buffer, and while the rewind key is held the
+// frames are popped off and restored instead of running the vm.
+
+package main
+
+import (
+	"bytes"
+	"log"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+)
+
+const rewindKey = ebiten.KeyBackspace
+
+// Reports whether the player is holding the rewind key and there
+// is any history to rewind through.
+func (g *Game) rewinding() bool {
+	return g.history != nil && g.history.Len() > 0 &&
+		!g.capturingKeys() && ebiten.IsKeyPressed(rewindKey)
+}
+
+// Snapshots the vm into the rewind buffer.
+func (g *Game) recordFrame() {
+	if g.history == nil {
+		return
+	}
+
+	g.snapshot.Reset()
+	if err := g.c8.SaveState(&g.snapshot); err != nil {
+		log.Printf("Error saving rewind state: %s\n", err)
+		return
+	}
+
+	g.history.Push(g.snapshot.Bytes())
+}
+
+// Restores the previous frame. The oldest frame is kept so holding
+// the key at the start of the history just stays there.
+func (g *Game) rewindFrame() {
+	state, ok := g.history.Pop()
+	if !ok {
+		return
+	}
+
+	if g.history.Len() == 0 {
+		g.history.Push(state)
+	}
+
+	if err := g.c8.LoadState(bytes.NewReader(state)); err != nil {
+		log.Printf("Error restoring rewind state: %s\n", err)
+	}
+}
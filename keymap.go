@@ -0,0 +1,343 @@
+// The keyboard mapping for the hex keypad. The default layout can
+// be changed, for every ROM or for one ROM, in keymap.json under
+// the user's config dir, or by pressing the keys one at a time in
+// the rebind window opened from the context menu.
+//
+// keymap.json maps the hex keys to Ebiten key names, with the
+// per-ROM overrides under the ROM's SHA-1:
+//
+//	{
+//	  "keys": {"5": "ArrowUp", "8": "ArrowDown"},
+//	  "roms": {"<sha1>": {"6": "Space"}}
+//	}
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	eimage "github.com/ebitenui/ebitenui/image"
+	"github.com/ebitenui/ebitenui/widget"
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+const (
+	rebindWidth  = 300
+	rebindHeight = 80
+
+	rebindCancelKey = ebiten.KeyEscape
+)
+
+// The keyboard key for each hex key.
+type keymap [16]ebiten.Key
+
+// The usual layout of the COSMAC VIP keypad on the left of a
+// QWERTY keyboard:
+//
+//	1 2 3 4        1 2 3 C
+//	Q W E R  -->   4 5 6 D
+//	A S D F        7 8 9 E
+//	Z X C V        A 0 B F
+var defaultKeymap = keymap{
+	0x1: ebiten.Key1, 0x2: ebiten.Key2, 0x3: ebiten.Key3, 0xc: ebiten.Key4,
+	0x4: ebiten.KeyQ, 0x5: ebiten.KeyW, 0x6: ebiten.KeyE, 0xd: ebiten.KeyR,
+	0x7: ebiten.KeyA, 0x8: ebiten.KeyS, 0x9: ebiten.KeyD, 0xe: ebiten.KeyF,
+	0xa: ebiten.KeyZ, 0x0: ebiten.KeyX, 0xb: ebiten.KeyC, 0xf: ebiten.KeyV,
+}
+
+// The order the rebind window asks for the keys in, row by row.
+var rebindOrder = [16]chip8.Key{
+	0x1, 0x2, 0x3, 0xc,
+	0x4, 0x5, 0x6, 0xd,
+	0x7, 0x8, 0x9, 0xe,
+	0xa, 0x0, 0xb, 0xf,
+}
+
+// Returns the keys held down, one bit per hex key.
+func (km *keymap) state() uint16 {
+	var keys uint16
+	for k, key := range km {
+		keys |= uint16(btoi(ebiten.IsKeyPressed(key))) << k
+	}
+
+	return keys
+}
+
+// Sets the keys in m, which maps hex digits to keyboard keys.
+func (km *keymap) apply(m map[string]ebiten.Key) error {
+	for digit, key := range m {
+		k, err := hexKey(digit)
+		if err != nil {
+			return err
+		}
+		km[k] = key
+	}
+
+	return nil
+}
+
+// Parses a hex key from keymap.json.
+func hexKey(digit string) (chip8.Key, error) {
+	k, err := strconv.ParseUint(digit, 16, 4)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown keypad key %q.", digit)
+	}
+
+	return chip8.Key(k), nil
+}
+
+// Returns the keys as keymap.json has them.
+func (km *keymap) encode() map[string]ebiten.Key {
+	m := make(map[string]ebiten.Key, len(km))
+	for k, key := range km {
+		m[strconv.FormatUint(uint64(k), 16)] = key
+	}
+
+	return m
+}
+
+// The layout of keymap.json.
+type keymapConfig struct {
+	// Overrides for every ROM.
+	Keys map[string]ebiten.Key `json:"keys,omitempty"`
+
+	// Overrides for a single ROM, by its SHA-1.
+	Roms map[string]map[string]ebiten.Key `json:"roms,omitempty"`
+
+	// The same for gamepads, mapping actions to hex keys, see
+	// gamepad.go.
+	Gamepad     map[string]string            `json:"gamepad,omitempty"`
+	RomGamepads map[string]map[string]string `json:"romGamepads,omitempty"`
+
+	// Where the config is saved, empty if it is only kept in
+	// memory.
+	file string
+}
+
+// Returns the keymap config, or an empty one if there is none yet.
+func loadKeymaps() (*keymapConfig, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &keymapConfig{file: filepath.Join(dir, "gochip", "keymap.json")}
+
+	b, err := os.ReadFile(c.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.file, err)
+	}
+
+	// Catch bad hex keys now rather than on every ROM.
+	if _, err := c.forRom(""); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.file, err)
+	}
+	for hash := range c.Roms {
+		if _, err := c.forRom(hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.file, err)
+		}
+	}
+	if _, err := c.padmapForRom("", nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.file, err)
+	}
+	for hash := range c.RomGamepads {
+		if _, err := c.padmapForRom(hash, nil); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.file, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *keymapConfig) save() error {
+	if c.file == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.file), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.file, b, 0o644)
+}
+
+// Returns the keymap for the ROM with the given hash, which is the
+// default with the overrides for every ROM and then the ROM's own
+// applied. An empty hash gets the keymap for every ROM.
+func (c *keymapConfig) forRom(hash string) (keymap, error) {
+	km := defaultKeymap
+	if err := km.apply(c.Keys); err != nil {
+		return defaultKeymap, err
+	}
+
+	if hash != "" {
+		if err := km.apply(c.Roms[hash]); err != nil {
+			return defaultKeymap, err
+		}
+	}
+
+	return km, nil
+}
+
+// Saves the keymap for the ROM with the given hash, or for every
+// ROM if the hash is empty.
+func (c *keymapConfig) set(hash string, km keymap) {
+	if hash == "" {
+		c.Keys = km.encode()
+		return
+	}
+
+	if c.Roms == nil {
+		c.Roms = map[string]map[string]ebiten.Key{}
+	}
+	c.Roms[hash] = km.encode()
+}
+
+// The window asking for the key to use for each hex key in turn.
+type rebinder struct {
+	window *widget.Window
+	text   *widget.Text
+
+	// The keys chosen so far, and which of rebindOrder is being
+	// asked for.
+	keys keymap
+	next int
+
+	// The ROM the keys are for, empty for every ROM.
+	hash string
+}
+
+func newRebinder() *rebinder {
+	r := &rebinder{}
+
+	face, _ := loadFont(8, font)
+
+	contents := widget.NewContainer(
+		widget.ContainerOpts.BackgroundImage(eimage.NewNineSliceColor(color.NRGBA{30, 30, 30, 255})),
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+			widget.RowLayoutOpts.Padding(widget.NewInsetsSimple(10)),
+		)),
+	)
+
+	r.text = widget.NewText(
+		widget.TextOpts.Text("", face, color.NRGBA{254, 255, 255, 255}),
+		widget.TextOpts.WidgetOpts(widget.WidgetOpts.MinSize(rebindWidth-20, rebindHeight-20)),
+	)
+	contents.AddChild(r.text)
+
+	r.window = widget.NewWindow(
+		widget.WindowOpts.Contents(contents),
+		widget.WindowOpts.Modal(),
+		widget.WindowOpts.CloseMode(widget.CLICK_OUT),
+		widget.WindowOpts.MinSize(rebindWidth, rebindHeight),
+	)
+
+	return r
+}
+
+// Opens the rebind window, for the loaded ROM only if forRom is
+// set.
+func (g *Game) startRebind(forRom bool) {
+	r := g.rebind
+	if g.ui.IsWindowOpen(r.window) {
+		return
+	}
+
+	r.hash = ""
+	if forRom {
+		if g.romHash == "" {
+			g.notify("No ROM loaded.")
+			return
+		}
+		r.hash = g.romHash
+	}
+
+	r.keys, _ = g.keymaps.forRom(r.hash)
+	r.next = 0
+	r.prompt()
+
+	x := romListWidth + (winWidth-rebindWidth)/2
+	y := (winHeight - rebindHeight) / 2
+	r.window.SetLocation(image.Rect(x, y, x+rebindWidth, y+rebindHeight))
+	g.ui.AddWindow(r.window)
+}
+
+// Reports whether the rebind window is waiting for keys.
+func (g *Game) rebinding() bool {
+	return g.ui.IsWindowOpen(g.rebind.window)
+}
+
+// Takes the next key pressed in the rebind window, saving the
+// keymap once every hex key has one.
+func (g *Game) handleRebindKeys() {
+	if !g.rebinding() {
+		return
+	}
+
+	r := g.rebind
+	if inpututil.IsKeyJustPressed(rebindCancelKey) {
+		r.window.Close()
+		return
+	}
+
+	pressed := inpututil.AppendJustPressedKeys(nil)
+	if len(pressed) == 0 {
+		return
+	}
+
+	r.keys[rebindOrder[r.next]] = pressed[0]
+	r.next++
+	if r.next < len(rebindOrder) {
+		r.prompt()
+		return
+	}
+
+	r.window.Close()
+
+	g.keymaps.set(r.hash, r.keys)
+	if err := g.keymaps.save(); err != nil {
+		g.notify(err.Error())
+		return
+	}
+
+	g.keys, _ = g.keymaps.forRom(g.romHash)
+	g.notify("Keys saved")
+}
+
+// Asks for the next key.
+func (r *rebinder) prompt() {
+	k := rebindOrder[r.next]
+
+	scope := "every ROM"
+	if r.hash != "" {
+		scope = "this ROM"
+	}
+
+	r.text.Label = fmt.Sprintf(
+		"Keys for %s (%d/16)\n\nPress the key for %X, now %s\n\nEsc cancels",
+		scope, r.next+1, k, r.keys[k],
+	)
+}
@@ -0,0 +1,269 @@
+// Package library keeps the user's ROM library: the directories
+// scanned for ROMs, the metadata cached for each ROM found in them
+// and the favourite and recently played ROMs. It is saved as JSON
+// between sessions.
+//
+// ROMs are remembered by their hash so favourites and recents
+// follow a ROM wherever it is, including the ones bundled with the
+// emulator.
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oliveira-a/gochip/chip8/asm"
+	"github.com/oliveira-a/gochip/romdb"
+)
+
+// How many recently played ROMs are kept.
+const MaxRecent = 8
+
+// The extensions directories are scanned for.
+var Extensions = []string{".ch8", ".c8", ".sc8", ".xo8", ".8o"}
+
+// Reports whether the file name has one of the ROM extensions.
+func IsRom(name string) bool {
+	return slices.Contains(Extensions, strings.ToLower(path.Ext(name)))
+}
+
+// What is known about a ROM from its contents.
+type Meta struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+
+	// The title from the ROM database, empty if it is unknown.
+	Title string `json:"title,omitempty"`
+
+	// The database id of the platform the ROM is for, such as
+	// "originalChip8" or "superchip". Guessed from the extension
+	// if the database does not know the ROM, and empty if that
+	// says nothing either.
+	Platform string `json:"platform,omitempty"`
+}
+
+// Returns the metadata for the ROM named name. Octo sources are
+// known by the hash of the program they assemble to, as they are
+// everywhere else, and not looked up if they do not assemble.
+func Describe(name string, rom []byte) Meta {
+	m := Meta{
+		Size:     int64(len(rom)),
+		Platform: extensionPlatforms[strings.ToLower(path.Ext(name))],
+	}
+
+	program, err := asm.Load(name, rom)
+	if err != nil {
+		m.Hash = romdb.Hash(rom)
+		return m
+	}
+	m.Hash = romdb.Hash(program)
+
+	if db, err := romdb.Default(); err == nil {
+		if info, ok := db.LookupHash(m.Hash); ok {
+			m.Title = info.Title
+			if len(info.Platforms) > 0 {
+				m.Platform = info.Platforms[0]
+			}
+		}
+	}
+
+	return m
+}
+
+// The platforms implied by the extensions that imply one.
+var extensionPlatforms = map[string]string{
+	".sc8": "superchip",
+	".xo8": "xochip",
+}
+
+// A ROM found in one of the library's directories.
+type Entry struct {
+	// The absolute path to the ROM.
+	Path string `json:"path"`
+
+	// The modification time the metadata was read at. The ROM is
+	// only read again if it changes.
+	ModTime time.Time `json:"modTime"`
+
+	Meta
+}
+
+type Library struct {
+	// The directories scanned for ROMs, recursively.
+	Dirs []string `json:"dirs"`
+
+	// The ROMs found by the last scan, by path.
+	Entries []Entry `json:"entries"`
+
+	// Hashes of the favourite ROMs.
+	Favourites []string `json:"favourites"`
+
+	// Hashes of the recently played ROMs, most recent first.
+	Recent []string `json:"recent"`
+
+	// Where the library is saved.
+	file string
+}
+
+// Returns the library saved in file, or an empty one if there is
+// none yet.
+func Load(file string) (*Library, error) {
+	l := &Library{file: file}
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Writes the library back to the file it was loaded from. A
+// library that was not loaded from a file is only kept in memory.
+func (l *Library) Save() error {
+	if l.file == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.file), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(l.file, b, 0o644)
+}
+
+// Adds a directory to be scanned, unless it already is. Reports
+// whether it was added.
+func (l *Library) AddDir(dir string) (bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+
+	if slices.Contains(l.Dirs, dir) {
+		return false, nil
+	}
+
+	l.Dirs = append(l.Dirs, dir)
+
+	return true, nil
+}
+
+// Walks the directories for ROMs and replaces the entries with the
+// ones found. ROMs that have not changed since the last scan keep
+// their metadata without being read. Directories that cannot be
+// read are skipped, and the first such error is returned once the
+// rest have been scanned.
+func (l *Library) Scan() error {
+	cached := map[string]Entry{}
+	for _, e := range l.Entries {
+		cached[e.Path] = e
+	}
+
+	var (
+		entries  []Entry
+		firstErr error
+	)
+	for _, dir := range l.Dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				// Carry on with the rest of the tree.
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if d.IsDir() || !IsRom(d.Name()) {
+				return nil
+			}
+
+			st, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			if e, ok := cached[p]; ok && e.Size == st.Size() && e.ModTime.Equal(st.ModTime()) {
+				entries = append(entries, e)
+				return nil
+			}
+
+			rom, err := os.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+
+			entries = append(entries, Entry{
+				Path:    p,
+				ModTime: st.ModTime(),
+				Meta:    Describe(d.Name(), rom),
+			})
+
+			return nil
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	l.Entries = entries
+
+	return firstErr
+}
+
+// Reports whether the ROM with the given hash is a favourite.
+func (l *Library) IsFavourite(hash string) bool {
+	return slices.Contains(l.Favourites, hash)
+}
+
+// Makes the ROM with the given hash a favourite or not.
+func (l *Library) SetFavourite(hash string, fav bool) {
+	l.Favourites = slices.DeleteFunc(l.Favourites, func(h string) bool {
+		return h == hash
+	})
+
+	if fav {
+		l.Favourites = append(l.Favourites, hash)
+	}
+}
+
+// Moves the ROM with the given hash to the front of the recently
+// played ones.
+func (l *Library) Played(hash string) {
+	l.Recent = slices.DeleteFunc(l.Recent, func(h string) bool {
+		return h == hash
+	})
+
+	l.Recent = append([]string{hash}, l.Recent...)
+	if len(l.Recent) > MaxRecent {
+		l.Recent = l.Recent[:MaxRecent]
+	}
+}
+
+// Returns how recently the ROM with the given hash was played, 0
+// being the last one, or -1 if it is not one of the recent ones.
+func (l *Library) RecentIndex(hash string) int {
+	return slices.Index(l.Recent, hash)
+}
@@ -0,0 +1,198 @@
+package library
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oliveira-a/gochip/chip8/disasm"
+	"github.com/oliveira-a/gochip/romdb"
+)
+
+func writeFile(t *testing.T, p string, b []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScansRecursively(t *testing.T) {
+	dir := t.TempDir()
+
+	tictac, err := os.ReadFile("../static/roms/tictac.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "tictac.ch8"), tictac)
+	writeFile(t, filepath.Join(dir, "schip", "game.SC8"), []byte{0x00, 0xff})
+	writeFile(t, filepath.Join(dir, "schip", "readme.txt"), []byte("hello"))
+
+	l := &Library{}
+	if _, err := l.AddDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Entries) != 2 {
+		t.Fatalf("got %d entries", len(l.Entries))
+	}
+
+	got := map[string]Entry{}
+	for _, e := range l.Entries {
+		got[filepath.Base(e.Path)] = e
+	}
+
+	if e := got["tictac.ch8"]; e.Title != "Tic-Tac-Toe" || e.Platform != "originalChip8" || e.Size != int64(len(tictac)) {
+		t.Fatalf("got %+v", e)
+	}
+	if e := got["game.SC8"]; e.Title != "" || e.Platform != "superchip" || e.Size != 2 {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestRescanKeepsUnchangedMetadata(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.ch8")
+	writeFile(t, p, []byte{0x12, 0x00})
+
+	l := &Library{}
+	l.AddDir(dir)
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only an unchanged ROM keeps what was cached for it.
+	l.Entries[0].Title = "Cached"
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Entries[0].Title != "Cached" {
+		t.Fatalf("got %+v", l.Entries[0])
+	}
+
+	writeFile(t, p, []byte{0x12, 0x00, 0x00})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(p, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Entries[0].Title != "" || l.Entries[0].Size != 3 {
+		t.Fatalf("got %+v", l.Entries[0])
+	}
+
+	os.Remove(p)
+	if err := l.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Entries) != 0 {
+		t.Fail()
+	}
+}
+
+func TestAddsDirsOnce(t *testing.T) {
+	dir := t.TempDir()
+
+	l := &Library{}
+	if ok, _ := l.AddDir(dir); !ok {
+		t.Fail()
+	}
+	if ok, _ := l.AddDir(filepath.Join(dir, ".")); ok {
+		t.Fail()
+	}
+	if len(l.Dirs) != 1 {
+		t.Fail()
+	}
+}
+
+func TestKeepsRecentMostRecentFirst(t *testing.T) {
+	l := &Library{}
+
+	for _, h := range []string{"a", "b", "c", "a"} {
+		l.Played(h)
+	}
+	if l.RecentIndex("a") != 0 || l.RecentIndex("c") != 1 || l.RecentIndex("b") != 2 || l.RecentIndex("d") != -1 {
+		t.Fatalf("got %v", l.Recent)
+	}
+
+	for i := 0; i < MaxRecent*2; i++ {
+		l.Played(string(rune('e' + i)))
+	}
+	if len(l.Recent) != MaxRecent {
+		t.Fatalf("got %v", l.Recent)
+	}
+}
+
+func TestTogglesFavourites(t *testing.T) {
+	l := &Library{}
+
+	l.SetFavourite("a", true)
+	l.SetFavourite("a", true)
+	l.SetFavourite("b", true)
+	l.SetFavourite("b", false)
+
+	if !l.IsFavourite("a") || l.IsFavourite("b") || len(l.Favourites) != 1 {
+		t.Fatalf("got %v", l.Favourites)
+	}
+}
+
+func TestSavesAndLoads(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gochip", "library.json")
+
+	l, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Dirs) != 0 {
+		t.Fail()
+	}
+
+	l.Dirs = []string{"/roms"}
+	l.Entries = []Entry{{Path: "/roms/a.ch8", ModTime: time.Unix(100, 0), Meta: Meta{Hash: "aa", Size: 2, Title: "A"}}}
+	l.SetFavourite("aa", true)
+	l.Played("bb")
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Dirs[0] != "/roms" || got.Entries[0].Meta != l.Entries[0].Meta ||
+		!got.Entries[0].ModTime.Equal(l.Entries[0].ModTime) ||
+		!got.IsFavourite("aa") || got.RecentIndex("bb") != 0 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDescribesOctoSourcesByTheirProgram(t *testing.T) {
+	tictac, err := os.ReadFile("../static/roms/tictac.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var src bytes.Buffer
+	if err := disasm.Disassemble(tictac, 0x200).WriteOcto(&src); err != nil {
+		t.Fatal(err)
+	}
+
+	m := Describe("tictac.8o", src.Bytes())
+	if m.Hash != romdb.Hash(tictac) || m.Title != "Tic-Tac-Toe" {
+		t.Fatalf("got %+v", m)
+	}
+
+	if m := Describe("broken.8o", []byte("jump nowhere")); m.Hash == "" || m.Title != "" {
+		t.Fatalf("got %+v", m)
+	}
+}
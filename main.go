@@ -1,30 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"embed"
 	"flag"
 	"fmt"
 	"image/color"
-	"io"
-	"io/fs"
 	"log"
-	"strings"
-	"time"
+	"os"
+	"path/filepath"
 
-	oto "github.com/ebitengine/oto/v3"
 	"github.com/ebitenui/ebitenui"
 	"github.com/ebitenui/ebitenui/widget"
 	ebiten "github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/go-mp3"
 	"github.com/oliveira-a/gochip/chip8"
+	"github.com/oliveira-a/gochip/library"
+	"github.com/oliveira-a/gochip/rewind"
+	"github.com/oliveira-a/gochip/romdb"
 )
 
 const (
 	winWidth     = 640
 	winHeight    = 320
-	tileSize     = 10
 	romListWidth = 150
 )
 
@@ -34,16 +33,32 @@ var (
 	//go:embed static/roms/*.ch8
 	roms embed.FS
 
-	//go:embed static/beep.mp3
-	beepMp3 []byte
-
-	beepChan chan int
-
 	backgroundColor color.Color = color.Black
 	tileColor       color.Color = color.White
 
+	// XO-CHIP colours for pixels lit on the second plane only
+	// and for pixels lit on both planes.
+	plane2Color color.Color = color.RGBA{0xaa, 0xaa, 0xaa, 0xff}
+	blendColor  color.Color = color.RGBA{0x55, 0x55, 0x55, 0xff}
+
+	// Indexed by a pixel's plane bits. ROMs may bring their own,
+	// see romdb.Info.Colors.
+	defaultPalette = [4]color.Color{backgroundColor, tileColor, plane2Color, blendColor}
+
 	debugModePtr = flag.Bool("debug", false, "Debug mode logs instructions to stdout.")
-	tickRatePtr  = flag.Int("tick", 60, "Start the emulator with a specified tick rate.")
+	tracePtr     = flag.String("trace", "", "Write a trace of every instruction to this file.")
+	traceFmtPtr  = flag.String("trace-format", "text", "The -trace file format: text, json or binary.")
+	ipfPtr       = flag.Int("ipf", 11, "How many instructions to execute per 60 Hz frame.")
+	seedPtr      = flag.Uint64("seed", 0, "Seed for the CXNN random number generator. Seeded from the clock if not set.")
+	rewindPtr    = flag.Int("rewind", 10, "Seconds of history kept for rewinding with Backspace. 0 disables it.")
+	platformPtr  = flag.String("platform", "chip8", "The platform to emulate: chip8, schip or xochip.")
+	tonePtr      = flag.Float64("tone", 440, "The frequency of the beep in Hz.")
+	volumePtr    = flag.Int("volume", 25, "The volume of the beep, from 0 to 100.")
+	mutePtr      = flag.Bool("mute", false, "Start with the sound muted. M toggles it.")
+	libraryPtr   = flag.String("library", "", "Directories to add to the ROM library, separated by "+string(os.PathListSeparator)+". They are remembered and scanned at start-up.")
+	palettePtr   = flag.String("palette", "", "The colour palette, such as amber or octo, or colours as in #000000,#ffcc00. Defaults to the ROM's colours.")
+	fadePtr      = flag.Bool("fade", false, "Fade cleared pixels out over a few frames to hide flicker.")
+	quirksPtr    = flag.String("quirks", "", "The quirks preset: vip, chip48, schip-modern, schip-legacy or xochip. Defaults to the platform's.")
 )
 
 // The single global game state structure that is created
@@ -52,44 +67,142 @@ type Game struct {
 	// The ebiten UI.
 	ui *ebitenui.UI
 
+	// The list of ROMs and the browser adding ones from disk.
+	romList *widget.List
+	browser *fileBrowser
+
+	// The ROM library and everything the list could show, along
+	// with the search box and sort order picking what it does.
+	library    *library.Library
+	roms       []*listItem
+	playing    *listItem
+	search     *widget.TextInput
+	sortBy     romSort
+	sortButton *widget.Button
+
+	// Set while the list reselects the playing ROM, which must
+	// not restart it.
+	refreshing bool
+
+	// The keymaps from keymap.json, the one for the loaded ROM and
+	// the window rebinding them.
+	keymaps *keymapConfig
+	keys    keymap
+	rebind  *rebinder
+
+	// The pads in use, player one first, and the keys for the
+	// loaded ROM's actions.
+	gamepads []ebiten.GamepadID
+	padmap   padmap
+
 	// The chip8 virtual machine that we load the ROM into.
 	c8 *chip8.VM
 
-	// This represents each square in the game screen.
-	tile *ebiten.Image
+	// The display at its native resolution, redrawn from the vm's
+	// frame whenever it changes and scaled up to the window.
+	display *ebiten.Image
+	pixels  []byte
+
+	// The colours in use, from the picked palette or the ROM's
+	// colours.
+	palette      [4]color.Color
+	paletteIndex int
+	romColors    []color.RGBA
+
+	// Whether cleared pixels fade out, and for each pixel how many
+	// frames it has left to fade and the plane bits it had.
+	fade     bool
+	fadeLeft []uint8
+	fadeFrom []uint8
+
+	// Instructions executed per frame. The timers always tick
+	// once per frame, so this only changes the game speed.
+	ipf int
+
+	// The debugger panel.
+	debugger *debugger
+
+	// Plays the vm's sound.
+	audio *squareSink
+
+	// Recent frames for hold-to-rewind, nil if disabled.
+	history  *rewind.Buffer
+	snapshot bytes.Buffer
+
+	// The hash of the loaded ROM, used to find its save states
+	// and keymap.
+	romHash string
+
+	// The fault that stopped the vm, if any. The vm stays paused
+	// until a ROM is loaded or the player rewinds.
+	fault error
+
+	// A message shown over the game, such as a save slot being
+	// written, and how many more frames to show it for.
+	status       string
+	statusFrames int
 }
 
 func (g *Game) Update() error {
-	err := g.c8.Cycle()
-	if err != nil {
-		return err
+	running := false
+	if g.rewinding() {
+		g.rewindFrame()
+		g.fault = nil
+		g.stepFade()
+	} else if g.fault == nil {
+		// Keep the window open on faults so they can be read,
+		// and rewound out of.
+		ran, err := g.runFrame()
+		if err != nil {
+			g.fault = err
+		} else if ran {
+			g.recordFrame()
+			g.stepFade()
+			running = true
+		}
 	}
 
-	g.c8.Keys[0x1] = uint8(btoi(ebiten.IsKeyPressed(ebiten.Key1)))
-	g.c8.Keys[0x2] = uint8(btoi(ebiten.IsKeyPressed(ebiten.Key2)))
-	g.c8.Keys[0x3] = uint8(btoi(ebiten.IsKeyPressed(ebiten.Key3)))
-	g.c8.Keys[0xc] = uint8(btoi(ebiten.IsKeyPressed(ebiten.Key4)))
+	// The sound timer only runs down while the vm does, so
+	// silence it otherwise.
+	g.audio.suspend(!running)
 
-	g.c8.Keys[0x4] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyQ)))
-	g.c8.Keys[0x5] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyW)))
-	g.c8.Keys[0x6] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyE)))
-	g.c8.Keys[0xd] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyR)))
+	g.handleRebindKeys()
+	g.handleGamepads()
 
-	g.c8.Keys[0x7] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyA)))
-	g.c8.Keys[0x8] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyS)))
-	g.c8.Keys[0x9] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyD)))
-	g.c8.Keys[0xe] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyF)))
+	// Keys typed into the search box or the rebind window are not
+	// for the game.
+	if !g.capturingKeys() {
+		g.handleSlotKeys()
+		g.handleOpenKey()
+		g.handleMuteKey()
+		g.debugger.handleKeys()
+	}
+	g.handleDroppedFiles()
+	g.debugger.refresh(g.c8)
 
-	g.c8.Keys[0xa] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyZ)))
-	g.c8.Keys[0x0] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyX)))
-	g.c8.Keys[0xb] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyC)))
-	g.c8.Keys[0xd] = uint8(btoi(ebiten.IsKeyPressed(ebiten.KeyV)))
+	// The vm queues the changes and applies them as it runs.
+	var keys uint16
+	if !g.capturingKeys() {
+		keys = g.keys.state()
+	}
+	keys |= g.gamepadKeys()
+	g.c8.Keypad.SetState(keys)
 
 	g.ui.Update()
 
 	return nil
 }
 
+// Runs the vm for one frame, under the debugger if it needs to
+// step or stop at breakpoints. Reports whether the vm ran at all.
+func (g *Game) runFrame() (bool, error) {
+	if g.debugger.active() {
+		return g.debugger.runFrame(g.c8, g.ipf)
+	}
+
+	return true, g.c8.RunFrame(g.ipf)
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
 	ebitenutil.DebugPrintAt(
 		screen,
@@ -97,23 +210,115 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		0, 0,
 	)
 
-	screen.Fill(backgroundColor)
-	g.tile.Fill(tileColor)
-
-	for x := 0; x < chip8.Cols; x++ {
-		for y := 0; y < chip8.Rows; y++ {
-			if g.c8.Vram[x][y] == 1 {
-				opts := &ebiten.DrawImageOptions{}
-				opts.GeoM.Translate(
-					float64(x*tileSize)+romListWidth,
-					float64(y*tileSize),
-				)
-				screen.DrawImage(g.tile, opts)
-			}
+	screen.Fill(g.palette[0])
+
+	// Scale the display so it always fills the window,
+	// whether we are in lo-res or hi-res mode.
+	g.updateDisplay()
+	ts := float64(winWidth / g.display.Bounds().Dx())
+
+	opts := &ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(ts, ts)
+	opts.GeoM.Translate(romListWidth, 0)
+	screen.DrawImage(g.display, opts)
+
+	g.ui.Draw(screen)
+
+	if g.fault != nil {
+		ebitenutil.DebugPrintAt(
+			screen,
+			fmt.Sprintf("%s\nSelect a ROM or hold Backspace to rewind.", g.fault),
+			romListWidth+5, 5,
+		)
+	}
+
+	if g.statusFrames > 0 {
+		ebitenutil.DebugPrintAt(screen, g.status, romListWidth+5, winHeight-20)
+		g.statusFrames--
+	}
+}
+
+// Uploads the vm's frame into the display image if it changed,
+// resizing the image when the resolution switches.
+func (g *Game) updateDisplay() {
+	f := g.c8.Frame()
+	cols, rows := f.Size()
+
+	if g.display == nil || g.display.Bounds().Dx() != cols {
+		g.display = ebiten.NewImage(cols, rows)
+		g.pixels = make([]byte, cols*rows*4)
+		g.fadeLeft = make([]uint8, cols*rows)
+		g.fadeFrom = make([]uint8, cols*rows)
+		f.Dirty = true
+	}
+
+	if !f.Dirty {
+		return
+	}
+
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			r, gr, b, a := g.pixelColor(y*cols+x, f.Pixel(x, y)).RGBA()
+			i := (y*cols + x) * 4
+			g.pixels[i] = uint8(r >> 8)
+			g.pixels[i+1] = uint8(gr >> 8)
+			g.pixels[i+2] = uint8(b >> 8)
+			g.pixels[i+3] = uint8(a >> 8)
 		}
 	}
 
-	g.ui.Draw(screen)
+	g.display.WritePixels(g.pixels)
+	f.Dirty = false
+}
+
+// Shows a message over the game for a couple of seconds.
+func (g *Game) notify(msg string) {
+	g.status = msg
+	g.statusFrames = 120
+}
+
+// Loads a ROM set up the way the ROM database says it should
+// run, unless the command line says otherwise.
+func (g *Game) loadRom(name string, rom []byte) error {
+	info, err := lookupRom(rom)
+	if err != nil {
+		return err
+	}
+
+	p, q, err := romPlatform(flag.CommandLine, *platformPtr, *quirksPtr, info)
+	if err != nil {
+		return err
+	}
+
+	g.c8.SetPlatform(p, q)
+	if err := g.c8.LoadRom(rom); err != nil {
+		return err
+	}
+
+	g.ipf = *ipfPtr
+	if info.TickRate > 0 && !isFlagSet(flag.CommandLine, "ipf") {
+		g.ipf = info.TickRate
+	}
+
+	g.romColors = info.Colors
+	g.applyPalette()
+
+	if info.Title != "" {
+		ebiten.SetWindowTitle(info.Title)
+	} else {
+		ebiten.SetWindowTitle(name)
+	}
+
+	g.romHash = romdb.Hash(rom)
+	g.keys, _ = g.keymaps.forRom(g.romHash)
+	g.padmap, _ = g.keymaps.padmapForRom(g.romHash, info.Keys)
+	g.fault = nil
+
+	if g.history != nil {
+		g.history.Clear()
+	}
+
+	return nil
 }
 
 func (g *Game) Layout(
@@ -128,115 +333,175 @@ func init() {
 }
 
 func main() {
+	if ok, err := runCommand(flag.Args()); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	opts, err := vmOptions(flag.CommandLine, *platformPtr, *quirksPtr, *seedPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tracer, closeTrace, err := newTracer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeTrace()
+	if tracer != nil {
+		opts = append(opts, chip8.WithTracer(tracer))
+	}
+
+	paletteIndex, err := parsePalette(*palettePtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sink := newSquareSink(*tonePtr, float64(*volumePtr)/100, *mutePtr)
+	c8 := chip8.New(append(opts, chip8.WithAudio(sink))...)
+
+	game = &Game{
+		c8: c8,
+
+		ipf: *ipfPtr,
+
+		paletteIndex: paletteIndex,
+
+		fade: *fadePtr,
+
+		audio: sink,
+	}
 
 	// UI setup
 	//
-	// Scan the ROMs in static/roms and extract their name
-	// for the list items.
-	entries, err := fs.ReadDir(roms, "static/roms")
+	// The list holds the embedded ROMs, the ones in the library
+	// and any opened from disk.
+	items, err := romItems(roms, "static/roms")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var listItems []any
-	for _, ent := range entries {
-		// avoids reading files without the '.ch8' extension.
-		if dn, ok := strings.CutSuffix(ent.Name(), ".ch8"); ok {
-			li := listItem{
-				name: dn,
-				path: fmt.Sprintf("%s/%s", "static/roms", ent.Name()),
-			}
-
-			listItems = append(listItems, li)
-		}
+	var libraryDirs []string
+	if *libraryPtr != "" {
+		libraryDirs = filepath.SplitList(*libraryPtr)
 	}
+	game.library = openLibrary(libraryDirs)
+	game.addRoms(items)
+	game.addRoms(libraryItems(game.library))
 
-	romList := newRomList(
-		listItems,
+	romContainer, romList := newRomList(
+		nil,
 		// Define how to handle the rom selection
-		func(args *widget.ListEntrySelectedEventArgs) {
-			rp := args.Entry.(listItem).path
-
-			rom, err := roms.ReadFile(rp)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			if err = game.c8.LoadRom(rom); err != nil {
-				log.Fatal(err)
-			}
-		},
+		game.romSelected,
 		romListWidth,
-		winHeight,
+		winHeight-libraryControlsHeight,
+	)
+	game.romList = romList
+
+	sidePanel := widget.NewContainer(
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+		)),
 	)
-	tickRateContextMenu := newTickRateContextMenu()
+	sidePanel.AddChild(game.newLibraryControls(romListWidth))
+	sidePanel.AddChild(romContainer)
+	game.refreshRomList()
+
+	game.browser = newFileBrowser(game.openRoms, game.addLibraryDir)
+	contextMenu := newContextMenu()
 
 	root := widget.NewContainer(
 		widget.ContainerOpts.Layout(widget.NewAnchorLayout()),
 		widget.ContainerOpts.WidgetOpts(
-			widget.WidgetOpts.ContextMenu(tickRateContextMenu)),
+			widget.WidgetOpts.ContextMenu(contextMenu)),
 	)
-	root.AddChild(romList)
+	root.AddChild(sidePanel)
 
-	beepChan = make(chan int)
-	game = &Game{
-		ui: &ebitenui.UI{Container: root},
+	game.debugger = newDebugger(c8)
+	root.AddChild(game.debugger.panel)
+
+	game.ui = &ebitenui.UI{Container: root}
+	game.applyPalette()
 
-		c8: chip8.New(beepChan, *debugModePtr),
+	keymaps, err := loadKeymaps()
+	if err != nil {
+		log.Printf("Error loading the keymap: %s\n", err)
+		keymaps = &keymapConfig{}
+	}
+	game.keymaps = keymaps
+	game.keys, _ = keymaps.forRom("")
+	game.padmap, _ = keymaps.padmapForRom("", nil)
+	game.rebind = newRebinder()
 
-		tile: ebiten.NewImage(tileSize, tileSize),
+	if *rewindPtr > 0 {
+		game.history = rewind.New(*rewindPtr * 60)
 	}
 
-	// set the default tick rate
-	ebiten.SetTPS(*tickRatePtr)
+	// A ROM or a directory of them given on the command line.
+	if flag.NArg() > 0 {
+		items, err := diskRomItems(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(items) == 0 {
+			log.Fatal(errNoRoms)
+		}
+		game.openRoms(items, 0)
+
+		// The browser starts next to them.
+		if st, err := os.Stat(flag.Arg(0)); err == nil && st.IsDir() {
+			game.browser.dir, _ = filepath.Abs(flag.Arg(0))
+		} else {
+			game.browser.dir, _ = filepath.Abs(filepath.Dir(flag.Arg(0)))
+		}
+	}
+
+	// The timers are ticked once per update, so this must stay
+	// at 60 regardless of the game speed.
+	ebiten.SetTPS(60)
 
 	ebiten.SetWindowSize(winWidth+romListWidth, winHeight)
 
-	// A go routine that listens for audio events through
-	// the beep channel. Plays the sound from 'beep.mp3'
-	go listenForAudio()
+	sink.start()
 
 	if err = ebiten.RunGame(game); err != nil {
+		closeTrace()
 		log.Fatal(err)
 	}
 }
 
-func listenForAudio() {
-	fileBytesReader := bytes.NewReader(beepMp3)
-	decodedMp3, err := mp3.NewDecoder(fileBytesReader)
-	if err != nil {
-		log.Printf("Error decoding mp3: %s\n", err)
-		return
+// Returns the tracer asked for by -debug or -trace, or nil, along
+// with a function flushing and closing the trace file.
+func newTracer() (chip8.Tracer, func(), error) {
+	if *tracePtr == "" {
+		if *debugModePtr {
+			return chip8.NewTextTracer(os.Stdout), func() {}, nil
+		}
+		return nil, func() {}, nil
 	}
 
-	op := &oto.NewContextOptions{}
-	op.SampleRate = 44100
-	op.ChannelCount = 2
-	op.Format = oto.FormatSignedInt16LE
-
-	otoCtx, readyChan, err := oto.NewContext(op)
+	f, err := os.Create(*tracePtr)
 	if err != nil {
-		log.Printf("Error creating new audio context: %s\n", err)
-		return
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(f)
+	closeTrace := func() {
+		w.Flush()
+		f.Close()
 	}
-	<-readyChan
-
-	player := otoCtx.NewPlayer(decodedMp3)
-	defer player.Close()
-
-	for {
-		<-beepChan
-		player.Play()
-
-		for player.IsPlaying() {
-			time.Sleep(time.Millisecond)
-		}
 
-		_, err := player.Seek(0, io.SeekStart)
-		if err != nil {
-			log.Printf("player.Seek failed: %s\n", err)
-			return
-		}
+	switch *traceFmtPtr {
+	case "text":
+		return chip8.NewTextTracer(w), closeTrace, nil
+	case "json":
+		return chip8.NewJSONTracer(w), closeTrace, nil
+	case "binary":
+		return chip8.NewBinaryTracer(w), closeTrace, nil
+	default:
+		closeTrace()
+		return nil, nil, fmt.Errorf("Unknown trace format %q.", *traceFmtPtr)
 	}
 }
 
@@ -0,0 +1,171 @@
+// Colour palettes and the pixel fade. A palette colours each value
+// of a pixel's plane bits, starting with the background. ROMs may
+// bring their own colours, which are used unless another palette
+// is picked with -palette or from the context menu.
+//
+// The fade keeps pixels that were just cleared lit for a few more
+// frames, fading out, like the phosphor of an old screen. It hides
+// the flicker of sprites erased and drawn again with XOR.
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// How many frames a cleared pixel takes to fade out.
+const fadeFrames = 6
+
+type palette struct {
+	name   string
+	colors [4]color.Color
+}
+
+// Returns a colour from its 0xrrggbb value.
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// The palettes to pick from. The first one is the ROM's own
+// colours, or the classic ones if it has none.
+var palettes = []palette{
+	{"ROM colours", defaultPalette},
+	{"Classic", defaultPalette},
+	{"Amber", [4]color.Color{rgb(0x1a0e00), rgb(0xffb000), rgb(0xb36b00), rgb(0xffd480)}},
+	{"Green phosphor", [4]color.Color{rgb(0x001a00), rgb(0x33ff33), rgb(0x1a991a), rgb(0xaaffaa)}},
+
+	// Octo's themes.
+	{"Octo", [4]color.Color{rgb(0x996600), rgb(0xffcc00), rgb(0xff6600), rgb(0x662200)}},
+	{"Octo LCD", [4]color.Color{rgb(0xf9ffb3), rgb(0x3d8026), rgb(0xabcc47), rgb(0x00131a)}},
+	{"Octo hotdog", [4]color.Color{rgb(0x000000), rgb(0xff0000), rgb(0xffff00), rgb(0xffffff)}},
+	{"Octo grey", [4]color.Color{rgb(0xaaaaaa), rgb(0x000000), rgb(0xffffff), rgb(0x666666)}},
+	{"Octo CGA", [4]color.Color{rgb(0x000000), rgb(0xff00ff), rgb(0x00ffff), rgb(0xffffff)}},
+
+	// From the Okabe-Ito colours, which stay apart for the common
+	// kinds of colour blindness.
+	{"Colour-blind dark", [4]color.Color{rgb(0x000000), rgb(0xe69f00), rgb(0x56b4e9), rgb(0xf0e442)}},
+	{"Colour-blind light", [4]color.Color{rgb(0xffffff), rgb(0x000000), rgb(0x0072b2), rgb(0xd55e00)}},
+}
+
+// Returns the index of the palette named by -palette, adding it
+// if it is a list of colours, as in "#000000,#ffcc00".
+func parsePalette(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	for i, p := range palettes {
+		if strings.EqualFold(p.name, s) {
+			return i, nil
+		}
+	}
+
+	if !strings.HasPrefix(s, "#") {
+		return 0, fmt.Errorf("Unknown palette %q.", s)
+	}
+
+	hexes := strings.Split(s, ",")
+	if len(hexes) < 2 || len(hexes) > 4 {
+		return 0, fmt.Errorf("A palette needs 2 to 4 colours, not %d.", len(hexes))
+	}
+
+	p := palette{name: "Custom", colors: defaultPalette}
+	for i, h := range hexes {
+		var v uint32
+		if _, err := fmt.Sscanf(strings.TrimSpace(h), "#%06x", &v); err != nil || len(strings.TrimSpace(h)) != 7 {
+			return 0, fmt.Errorf("Bad colour %q, expected #rrggbb.", h)
+		}
+		p.colors[i] = rgb(v)
+	}
+
+	palettes = append(palettes, p)
+
+	return len(palettes) - 1, nil
+}
+
+// Sets the colours from the picked palette, or from the ROM if the
+// first one is picked.
+func (g *Game) applyPalette() {
+	g.palette = palettes[g.paletteIndex].colors
+	if g.paletteIndex == 0 {
+		for i, c := range g.romColors {
+			if i < len(g.palette) {
+				g.palette[i] = c
+			}
+		}
+	}
+
+	g.c8.Frame().Dirty = true
+}
+
+// Moves on to the next palette.
+func (g *Game) cyclePalette() {
+	g.paletteIndex = (g.paletteIndex + 1) % len(palettes)
+	g.applyPalette()
+	g.notify(palettes[g.paletteIndex].name)
+}
+
+// Turns the pixel fade on or off.
+func (g *Game) toggleFade() {
+	g.fade = !g.fade
+	clear(g.fadeLeft)
+	g.c8.Frame().Dirty = true
+
+	if g.fade {
+		g.notify("Pixel fade on")
+	} else {
+		g.notify("Pixel fade off")
+	}
+}
+
+// Runs the fade down by one emulated frame. Lit pixels start over
+// with the colour they are lit with, and the display is redrawn
+// while any cleared ones are still fading.
+func (g *Game) stepFade() {
+	f := g.c8.Frame()
+	cols, rows := f.Size()
+	if !g.fade || len(g.fadeLeft) != cols*rows {
+		return
+	}
+
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			i := y*cols + x
+			if v := f.Pixel(x, y); v != 0 {
+				g.fadeFrom[i] = v
+				g.fadeLeft[i] = fadeFrames
+				continue
+			}
+
+			if g.fadeFrom[i] != 0 && g.fadeLeft[i] > 0 {
+				g.fadeLeft[i]--
+				f.Dirty = true
+			}
+		}
+	}
+}
+
+// Returns the colour of a pixel whose plane bits are v. Cleared
+// pixels take the colour they were lit with, blended into the
+// background as they fade.
+func (g *Game) pixelColor(i int, v uint8) color.Color {
+	if !g.fade || v != 0 || g.fadeFrom[i] == 0 || g.fadeLeft[i] == 0 {
+		return g.palette[v]
+	}
+
+	return blend(g.palette[0], g.palette[g.fadeFrom[i]], float64(g.fadeLeft[i])/(fadeFrames+1))
+}
+
+// Returns the colour t of the way from a to b.
+func blend(a, b color.Color, t float64) color.Color {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+
+	mix := func(x, y uint32) uint8 {
+		return uint8((float64(x)*(1-t) + float64(y)*t) / 0x101)
+	}
+
+	return color.RGBA{mix(ar, br), mix(ag, bg), mix(ab, bb), 0xff}
+}
@@ -0,0 +1,153 @@
+// Package rewind keeps a bounded history of vm save states so a
+// game can be run backwards.
+//
+// Only the newest state is kept whole. Every older state is stored
+// as the difference to the state that came after it, XORed and run
+// length encoded, which is tiny since a frame rarely touches more
+// than a handful of bytes.
+package rewind
+
+import "encoding/binary"
+
+type Buffer struct {
+	// The newest state in full.
+	latest []byte
+
+	// Ring of deltas. Applying deltas[i] to the state after it
+	// gives back the state before it.
+	deltas [][]byte
+
+	// Index of the oldest delta and how many are held.
+	start int
+	count int
+}
+
+// Creates a buffer holding up to capacity states.
+func New(capacity int) *Buffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Buffer{
+		deltas: make([][]byte, capacity-1),
+	}
+}
+
+// Returns how many states can be popped.
+func (b *Buffer) Len() int {
+	if b.latest == nil {
+		return 0
+	}
+
+	return b.count + 1
+}
+
+// Adds a state to the history, dropping the oldest one if the
+// buffer is full. The buffer keeps its own copy.
+func (b *Buffer) Push(state []byte) {
+	if b.latest != nil && len(b.deltas) > 0 {
+		d := encode(state, b.latest)
+
+		if b.count == len(b.deltas) {
+			b.start = (b.start + 1) % len(b.deltas)
+			b.count--
+		}
+
+		b.deltas[(b.start+b.count)%len(b.deltas)] = d
+		b.count++
+	}
+
+	b.latest = append(b.latest[:0:0], state...)
+}
+
+// Removes and returns the newest state. The returned slice is
+// owned by the caller.
+func (b *Buffer) Pop() ([]byte, bool) {
+	if b.latest == nil {
+		return nil, false
+	}
+
+	state := b.latest
+
+	if b.count == 0 {
+		b.latest = nil
+		return state, true
+	}
+
+	b.count--
+	i := (b.start + b.count) % len(b.deltas)
+	b.latest = decode(state, b.deltas[i])
+	b.deltas[i] = nil
+
+	return state, true
+}
+
+// Drops the whole history.
+func (b *Buffer) Clear() {
+	b.latest = nil
+	for i := range b.deltas {
+		b.deltas[i] = nil
+	}
+	b.start, b.count = 0, 0
+}
+
+// Encodes prev XOR cur as runs of (zero count, literal count,
+// literal bytes) with the counts as uvarints. The length of prev
+// is written first so states can change size.
+func encode(cur, prev []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(prev)))
+
+	at := func(s []byte, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+
+	for i := 0; i < len(prev); {
+		zeros := i
+		for zeros < len(prev) && at(cur, zeros) == prev[zeros] {
+			zeros++
+		}
+
+		lits := zeros
+		for lits < len(prev) && at(cur, lits) != prev[lits] {
+			lits++
+		}
+
+		out = binary.AppendUvarint(out, uint64(zeros-i))
+		out = binary.AppendUvarint(out, uint64(lits-zeros))
+		for j := zeros; j < lits; j++ {
+			out = append(out, at(cur, j)^prev[j])
+		}
+
+		i = lits
+	}
+
+	return out
+}
+
+// Applies a delta made by encode to cur, giving back prev.
+func decode(cur, delta []byte) []byte {
+	n, k := binary.Uvarint(delta)
+	delta = delta[k:]
+
+	prev := make([]byte, n)
+	copy(prev, cur)
+
+	for i := 0; len(delta) > 0; {
+		zeros, k := binary.Uvarint(delta)
+		delta = delta[k:]
+		lits, k := binary.Uvarint(delta)
+		delta = delta[k:]
+
+		i += int(zeros)
+		for j := 0; j < int(lits); j++ {
+			prev[i] ^= delta[j]
+			i++
+		}
+		delta = delta[lits:]
+	}
+
+	return prev
+}
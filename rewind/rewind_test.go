@@ -0,0 +1,74 @@
+package rewind
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPopsStatesNewestFirst(t *testing.T) {
+	b := New(10)
+	states := [][]byte{
+		{0, 0, 0, 0},
+		{0, 1, 0, 0},
+		{9, 1, 0, 7},
+		{9, 1},
+		{9, 1, 0, 7, 5},
+	}
+
+	for _, s := range states {
+		b.Push(s)
+	}
+
+	for i := len(states) - 1; i >= 0; i-- {
+		s, ok := b.Pop()
+		if !ok || !bytes.Equal(s, states[i]) {
+			t.Fatalf("pop %d = %v, want %v", i, s, states[i])
+		}
+	}
+
+	if _, ok := b.Pop(); ok {
+		t.Fail()
+	}
+}
+
+func TestDropsOldestStatesWhenFull(t *testing.T) {
+	b := New(3)
+	for i := 0; i < 5; i++ {
+		b.Push([]byte{byte(i)})
+	}
+
+	if b.Len() != 3 {
+		t.Fatalf("len = %d, want 3", b.Len())
+	}
+
+	for _, want := range []byte{4, 3, 2} {
+		if s, _ := b.Pop(); s[0] != want {
+			t.Fatalf("got %d, want %d", s[0], want)
+		}
+	}
+}
+
+func TestDeltasAreSmall(t *testing.T) {
+	b := New(2)
+	s := make([]byte, 1<<16)
+	b.Push(s)
+
+	s2 := append([]byte(nil), s...)
+	s2[1000] = 1
+	b.Push(s2)
+
+	if n := len(b.deltas[0]); n > 16 {
+		t.Fatalf("delta is %d bytes", n)
+	}
+}
+
+func TestPushKeepsItsOwnCopy(t *testing.T) {
+	b := New(2)
+	s := []byte{1, 2, 3}
+	b.Push(s)
+	s[0] = 9
+
+	if got, _ := b.Pop(); got[0] != 1 {
+		t.Fail()
+	}
+}
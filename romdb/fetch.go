@@ -0,0 +1,43 @@
+//go:build ignore
+
+// Downloads the upstream CHIP-8 database into database/, unchanged.
+// Run with go generate.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const upstream = "https://raw.githubusercontent.com/chip-8/chip-8-database/master/database/"
+
+func main() {
+	for _, name := range []string{"sha1-hashes.json", "programs.json", "platforms.json"} {
+		if err := fetch(name); err != nil {
+			log.Fatalf("Error fetching %s: %s\n", name, err)
+		}
+	}
+}
+
+func fetch(name string) error {
+	resp, err := http.Get(upstream + name)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status %s.", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join("database", name), b, 0o644)
+}
@@ -0,0 +1,276 @@
+// Package romdb identifies ROMs by their SHA-1 hash using the
+// community CHIP-8 database (https://github.com/chip-8/chip-8-database)
+// and translates its entries into the platforms and quirks of
+// package chip8.
+//
+// The database is embedded from database/, which go generate fills
+// with the upstream files, unchanged. Until it has been run there,
+// database/ only holds entries for some of the bundled ROMs.
+package romdb
+
+import (
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+//go:generate go run fetch.go
+
+//go:embed database/*.json
+var database embed.FS
+
+// Everything the database knows about a ROM.
+type Info struct {
+	// The program's title, falling back to the title embedded in
+	// the ROM if the program has none.
+	Title       string
+	Authors     []string
+	Description string
+	Release     string
+
+	// The database ids of the platforms the ROM runs on, best
+	// first, such as "originalChip8" or "superchip".
+	Platforms []string
+
+	// The first of Platforms the vm can emulate, and the quirks
+	// the ROM expects on it. Only valid if Supported is set.
+	Platform  chip8.Platform
+	Quirks    chip8.Quirks
+	Supported bool
+
+	// Instructions per frame, or 0 if the database has none for
+	// the ROM.
+	TickRate int
+
+	// The colour for each value of a pixel's plane bits, starting
+	// with the background. Nil if the database has none.
+	Colors []color.RGBA
+
+	// The keypad key behind each game action, such as "up" or
+	// "a".
+	Keys map[string]chip8.Key
+}
+
+// A loaded database.
+type DB struct {
+	hashes    map[string]int
+	programs  []program
+	platforms map[string]platform
+}
+
+// The layout of programs.json.
+type program struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Release     string         `json:"release"`
+	Authors     []string       `json:"authors"`
+	Roms        map[string]rom `json:"roms"`
+}
+
+type rom struct {
+	EmbeddedTitle   string                     `json:"embeddedTitle"`
+	Description     string                     `json:"description"`
+	Release         string                     `json:"release"`
+	Authors         []string                   `json:"authors"`
+	Platforms       []string                   `json:"platforms"`
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms"`
+	Tickrate        int                        `json:"tickrate"`
+	Keys            map[string]int             `json:"keys"`
+	Colors          struct {
+		Pixels []string `json:"pixels"`
+	} `json:"colors"`
+}
+
+// The layout of platforms.json.
+type platform struct {
+	ID     string          `json:"id"`
+	Quirks map[string]bool `json:"quirks"`
+}
+
+var (
+	defaultDB   *DB
+	defaultErr  error
+	defaultOnce sync.Once
+)
+
+// Returns the embedded database.
+func Default() (*DB, error) {
+	defaultOnce.Do(func() {
+		defaultDB, defaultErr = Open(database, "database")
+	})
+
+	return defaultDB, defaultErr
+}
+
+// Reads sha1-hashes.json, programs.json and platforms.json from
+// dir in fsys.
+func Open(fsys fs.FS, dir string) (*DB, error) {
+	db := &DB{platforms: map[string]platform{}}
+
+	var platforms []platform
+	for name, v := range map[string]any{
+		"sha1-hashes.json": &db.hashes,
+		"programs.json":    &db.programs,
+		"platforms.json":   &platforms,
+	} {
+		b, err := fs.ReadFile(fsys, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for _, p := range platforms {
+		db.platforms[p.ID] = p
+	}
+
+	return db, nil
+}
+
+// Returns the hex SHA-1 the database knows a ROM by.
+func Hash(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Looks up a ROM by its contents.
+func (db *DB) Lookup(b []byte) (Info, bool) {
+	return db.LookupHash(Hash(b))
+}
+
+// Looks up a ROM by its hex SHA-1.
+func (db *DB) LookupHash(hash string) (Info, bool) {
+	i, ok := db.hashes[strings.ToLower(hash)]
+	if !ok || i < 0 || i >= len(db.programs) {
+		return Info{}, false
+	}
+
+	p := db.programs[i]
+	r, ok := p.Roms[strings.ToLower(hash)]
+	if !ok {
+		return Info{}, false
+	}
+
+	info := Info{
+		Title:       p.Title,
+		Authors:     p.Authors,
+		Description: p.Description,
+		Release:     p.Release,
+		Platforms:   r.Platforms,
+		TickRate:    r.Tickrate,
+	}
+
+	// The ROM's own details win over the program's.
+	if info.Title == "" {
+		info.Title = r.EmbeddedTitle
+	}
+	if len(r.Authors) > 0 {
+		info.Authors = r.Authors
+	}
+	if r.Description != "" {
+		info.Description = r.Description
+	}
+	if r.Release != "" {
+		info.Release = r.Release
+	}
+
+	for _, id := range r.Platforms {
+		cp, ok := platformIDs[id]
+		if !ok {
+			continue
+		}
+
+		info.Platform = cp
+		info.Quirks = db.quirks(id, cp, r.QuirkyPlatforms[id])
+		info.Supported = true
+		break
+	}
+
+	for _, s := range r.Colors.Pixels {
+		c, err := parseColor(s)
+		if err != nil {
+			info.Colors = nil
+			break
+		}
+		info.Colors = append(info.Colors, c)
+	}
+
+	if len(r.Keys) > 0 {
+		info.Keys = make(map[string]chip8.Key, len(r.Keys))
+		for action, k := range r.Keys {
+			info.Keys[action] = chip8.Key(k & 0xf)
+		}
+	}
+
+	return info, true
+}
+
+// The database platforms the vm can emulate.
+var platformIDs = map[string]chip8.Platform{
+	"originalChip8": chip8.Chip8,
+	"hybridVIP":     chip8.Chip8,
+	"modernChip8":   chip8.Chip8,
+	"chip48":        chip8.Chip8,
+	"superchip1":    chip8.SuperChip,
+	"superchip":     chip8.SuperChip,
+	"xochip":        chip8.XOChip,
+}
+
+// Returns the quirks for a database platform, with the ROM's own
+// overrides applied. The database has no say on the quirks it
+// does not describe, which keep the vm platform's defaults.
+func (db *DB) quirks(id string, p chip8.Platform, overrides map[string]bool) chip8.Quirks {
+	q := chip8.DefaultQuirks(p)
+
+	flags := map[string]bool{}
+	for k, v := range db.platforms[id].Quirks {
+		flags[k] = v
+	}
+	for k, v := range overrides {
+		flags[k] = v
+	}
+
+	if v, ok := flags["shift"]; ok {
+		q.ShiftUsesVY = !v
+	}
+	if v, ok := flags["jump"]; ok {
+		q.JumpUsesVX = v
+	}
+	if v, ok := flags["wrap"]; ok {
+		q.Clip = !v
+	}
+	if v, ok := flags["logic"]; ok {
+		q.LogicResetsVF = v
+	}
+
+	switch {
+	case flags["memoryLeaveIUnchanged"]:
+		q.MemoryIncrement = chip8.IncrementNone
+	case flags["memoryIncrementByX"]:
+		q.MemoryIncrement = chip8.IncrementX
+	default:
+		q.MemoryIncrement = chip8.IncrementXPlus1
+	}
+
+	return q
+}
+
+// Parses a "#rrggbb" colour.
+func parseColor(s string) (color.RGBA, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return color.RGBA{}, fmt.Errorf("Invalid colour %q.", s)
+	}
+
+	return color.RGBA{b[0], b[1], b[2], 0xff}, nil
+}
@@ -0,0 +1,126 @@
+package romdb
+
+import (
+	"image/color"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/oliveira-a/gochip/chip8"
+)
+
+func TestIdentifiesBundledRoms(t *testing.T) {
+	db, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rom, err := os.ReadFile("../static/roms/tictac.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, ok := db.Lookup(rom)
+	if !ok || info.Title != "Tic-Tac-Toe" || !info.Supported ||
+		info.Platform != chip8.Chip8 || info.Quirks != chip8.QuirksVIP {
+		t.Fatalf("got %+v", info)
+	}
+
+	if _, ok := db.Lookup([]byte{0x12, 0x00}); ok {
+		t.Fail()
+	}
+}
+
+// The IBM logo, the first program most emulators run.
+var ibmLogo = []byte{
+	0x00, 0xe0, 0xa2, 0x2a, 0x60, 0x0c, 0x61, 0x08, 0xd0, 0x1f, 0x70, 0x09, 0xa2, 0x39, 0xd0, 0x1f,
+	0xa2, 0x48, 0x70, 0x08, 0xd0, 0x1f, 0x70, 0x04, 0xa2, 0x57, 0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x66,
+	0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x75, 0xd0, 0x1f, 0x12, 0x28, 0xff, 0x00, 0xff, 0x00, 0x3c, 0x00,
+	0x3c, 0x00, 0x3c, 0x00, 0x3c, 0x00, 0xff, 0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0x38, 0x00, 0x3f,
+	0x00, 0x3f, 0x00, 0x38, 0x00, 0xff, 0x00, 0xff, 0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00,
+	0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0xf8, 0x00, 0xfc, 0x00, 0x3e, 0x00, 0x3f, 0x00, 0x3b,
+	0x00, 0x39, 0x00, 0xf8, 0x00, 0xf8, 0x03, 0x00, 0x07, 0x00, 0x0f, 0x00, 0xbf, 0x00, 0xfb, 0x00,
+	0xf3, 0x00, 0xe3, 0x00, 0x43, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80,
+	0x00, 0xe0, 0x00, 0xe0,
+}
+
+func TestIdentifiesRomsThatAreNotBundled(t *testing.T) {
+	db, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.hashes) < 100 {
+		t.Skip("database/ only holds the bundled ROMs, run go generate ./romdb")
+	}
+
+	info, ok := db.LookupHash(Hash(ibmLogo))
+	if !ok || !strings.Contains(info.Title, "IBM") || info.Platform != chip8.Chip8 {
+		t.Fatalf("got %+v", info)
+	}
+
+	rom, err := os.ReadFile("../static/roms/acattd1.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Lookup(rom); !ok {
+		t.Fatal("acattd1.ch8 not found")
+	}
+}
+
+var testDB = fstest.MapFS{
+	"db/sha1-hashes.json": {Data: []byte(`{"aa": 0, "bb": 0, "cc": 1}`)},
+	"db/programs.json": {Data: []byte(`[
+		{
+			"title": "Game",
+			"authors": ["Someone"],
+			"roms": {
+				"aa": {
+					"platforms": ["superchip"],
+					"quirkyPlatforms": {"superchip": {"wrap": true}},
+					"tickrate": 40,
+					"colors": {"pixels": ["#000000", "#ff8000"]},
+					"keys": {"up": 5, "a": 6}
+				},
+				"bb": {"platforms": ["megachip8", "xochip"], "authors": ["Someone else"]}
+			}
+		},
+		{"roms": {"cc": {"embeddedTitle": "CC", "platforms": ["megachip8"]}}}
+	]`)},
+	"db/platforms.json": {Data: []byte(`[
+		{"id": "superchip", "quirks": {"shift": true, "memoryLeaveIUnchanged": true, "wrap": false, "jump": true, "logic": false}},
+		{"id": "xochip", "quirks": {"shift": false, "wrap": true, "jump": false, "logic": false}}
+	]`)},
+}
+
+func TestTranslatesEntries(t *testing.T) {
+	db, err := Open(testDB, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, ok := db.LookupHash("AA")
+	want := chip8.QuirksSuperChipModern
+	want.Clip = false
+
+	if !ok || info.Platform != chip8.SuperChip || info.Quirks != want || info.TickRate != 40 ||
+		len(info.Colors) != 2 || info.Colors[1] != (color.RGBA{0xff, 0x80, 0x00, 0xff}) ||
+		info.Keys["up"] != 5 || info.Keys["a"] != 6 {
+		t.Fatalf("got %+v", info)
+	}
+}
+
+func TestSkipsPlatformsTheVMCannotRun(t *testing.T) {
+	db, _ := Open(testDB, "db")
+
+	info, _ := db.LookupHash("bb")
+	if !info.Supported || info.Platform != chip8.XOChip || info.Quirks != chip8.QuirksXOChip ||
+		info.Authors[0] != "Someone else" {
+		t.Fatalf("got %+v", info)
+	}
+
+	info, ok := db.LookupHash("cc")
+	if !ok || info.Supported || info.Title != "CC" {
+		t.Fatalf("got %+v", info)
+	}
+}
@@ -0,0 +1,126 @@
+// ROMs from outside the binary. A ROM file or a directory of them
+// can be given on the command line, picked in the file browser
+// (Ctrl+O or the context menu) or dropped onto the window. They
+// are added to the ROM list along with the embedded ones.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/oliveira-a/gochip/chip8/asm"
+	"github.com/oliveira-a/gochip/library"
+)
+
+var errNoRoms = errors.New("No ROMs found.")
+
+// Returns a list item for the ROM at p in fsys, or one for each
+// ROM file in it if it is a directory. Files are taken whatever
+// their extension since they were asked for by name.
+func romItems(fsys fs.FS, p string) ([]*listItem, error) {
+	st, err := fs.Stat(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !st.IsDir() {
+		return []*listItem{newListItem(fsys, p)}, nil
+	}
+
+	entries, err := fs.ReadDir(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*listItem
+	for _, e := range entries {
+		if !e.IsDir() && library.IsRom(e.Name()) {
+			items = append(items, newListItem(fsys, path.Join(p, e.Name())))
+		}
+	}
+
+	return items, nil
+}
+
+// Returns the ROMs at a path on disk, see romItems.
+func diskRomItems(p string) ([]*listItem, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return romItems(os.DirFS(filepath.Dir(abs)), filepath.Base(abs))
+}
+
+// Returns a list item named after the file, described by the ROM
+// database if it knows the ROM.
+func newListItem(fsys fs.FS, p string) *listItem {
+	li := &listItem{
+		name: strings.TrimSuffix(path.Base(p), path.Ext(p)),
+		path: p,
+		fsys: fsys,
+	}
+
+	if rom, err := fs.ReadFile(fsys, p); err == nil {
+		li.meta = library.Describe(p, rom)
+	}
+
+	return li
+}
+
+// Reads the ROM, assembling it first if it is Octo source.
+func (li *listItem) read() ([]byte, error) {
+	rom, err := fs.ReadFile(li.fsys, li.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return asm.Load(li.path, rom)
+}
+
+// Adds the ROMs to the list and starts the picked one.
+func (g *Game) openRoms(items []*listItem, picked int) {
+	if len(items) == 0 {
+		g.notify(errNoRoms.Error())
+		return
+	}
+
+	items = g.addRoms(items)
+
+	// Selecting the entry loads it, so it has to be listed.
+	g.search.SetText("")
+	g.refreshRomList()
+	g.romList.SetSelectedEntry(items[picked])
+}
+
+// Opens the ROMs dropped onto the window, if any.
+func (g *Game) handleDroppedFiles() {
+	dropped := ebiten.DroppedFiles()
+	if dropped == nil {
+		return
+	}
+
+	entries, err := fs.ReadDir(dropped, ".")
+	if err != nil {
+		g.notify(err.Error())
+		return
+	}
+
+	var items []*listItem
+	for _, e := range entries {
+		its, err := romItems(dropped, e.Name())
+		if err != nil {
+			g.notify(err.Error())
+			return
+		}
+		items = append(items, its...)
+	}
+
+	g.openRoms(items, 0)
+}
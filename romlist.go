@@ -0,0 +1,364 @@
+// The ROM library in the side list. The list holds the bundled
+// ROMs, the ones opened from disk and the ones found in the
+// library's directories, filtered by the search box and sorted.
+// Favourites come first and the recently played ROMs get their own
+// section at the top.
+
+package main
+
+import (
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ebitenui/ebitenui/image"
+	"github.com/ebitenui/ebitenui/widget"
+	"github.com/oliveira-a/gochip/library"
+)
+
+// The height of the search box and the buttons above the list.
+const libraryControlsHeight = 50
+
+// How the list is sorted.
+type romSort int
+
+const (
+	sortByTitle romSort = iota
+	sortByPlatform
+	sortBySize
+)
+
+var romSortLabels = [...]string{
+	sortByTitle:    "By title",
+	sortByPlatform: "By system",
+	sortBySize:     "By size",
+}
+
+// A heading in the list, which does nothing when clicked.
+type sectionHeader string
+
+// A recently played ROM, listed again in the recent section. It
+// has to be a different value from the ROM's own entry to be in
+// the list twice.
+type recentItem struct {
+	*listItem
+}
+
+// Returns where the library is saved.
+func libraryFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "gochip", "library.json"), nil
+}
+
+// Loads the library, adds the directories given on the command
+// line and scans them all. Errors are logged rather than fatal,
+// since the emulator works without a library.
+func openLibrary(dirs []string) *library.Library {
+	file, err := libraryFile()
+	if err != nil {
+		log.Printf("Error finding the ROM library: %s\n", err)
+		return &library.Library{}
+	}
+
+	l, err := library.Load(file)
+	if err != nil {
+		log.Printf("Error loading the ROM library: %s\n", err)
+		return &library.Library{}
+	}
+
+	for _, dir := range dirs {
+		if _, err := l.AddDir(dir); err != nil {
+			log.Printf("Error adding %s to the ROM library: %s\n", dir, err)
+		}
+	}
+
+	if err := l.Scan(); err != nil {
+		log.Printf("Error scanning the ROM library: %s\n", err)
+	}
+
+	if err := l.Save(); err != nil {
+		log.Printf("Error saving the ROM library: %s\n", err)
+	}
+
+	return l
+}
+
+// Returns a list item for each ROM in the library.
+func libraryItems(l *library.Library) []*listItem {
+	var items []*listItem
+	for _, e := range l.Entries {
+		items = append(items, &listItem{
+			name: strings.TrimSuffix(filepath.Base(e.Path), filepath.Ext(e.Path)),
+			path: filepath.Base(e.Path),
+			fsys: os.DirFS(filepath.Dir(e.Path)),
+			meta: e.Meta,
+		})
+	}
+
+	return items
+}
+
+// Returns what the list shows for an entry.
+func romLabel(e any) string {
+	switch e := e.(type) {
+	case sectionHeader:
+		return "- " + string(e) + " -"
+	case recentItem:
+		return e.label()
+	case *listItem:
+		if game != nil && game.library.IsFavourite(e.meta.Hash) {
+			return "*" + e.label()
+		}
+		return e.label()
+	}
+
+	return ""
+}
+
+// Returns the ROM's title, or its file name if it has none.
+func (li *listItem) label() string {
+	if li.meta.Title != "" {
+		return li.meta.Title
+	}
+
+	return li.name
+}
+
+// Adds the ROMs to the list and returns them, with the ones
+// already listed replaced by the listed ones.
+func (g *Game) addRoms(items []*listItem) []*listItem {
+	added := make([]*listItem, len(items))
+
+	for i, li := range items {
+		added[i] = li
+		for _, r := range g.roms {
+			if li.meta.Hash != "" && r.meta.Hash == li.meta.Hash {
+				added[i] = r
+				break
+			}
+		}
+
+		if added[i] == li {
+			g.roms = append(g.roms, li)
+		}
+	}
+
+	return added
+}
+
+// Adds a directory to the library and lists the ROMs in it.
+func (g *Game) addLibraryDir(dir string) {
+	if _, err := g.library.AddDir(dir); err != nil {
+		g.notify(err.Error())
+		return
+	}
+
+	if err := g.library.Scan(); err != nil {
+		g.notify(err.Error())
+	}
+	g.saveLibrary()
+
+	g.addRoms(libraryItems(g.library))
+	g.refreshRomList()
+	g.notify("Added to the library")
+}
+
+func (g *Game) saveLibrary() {
+	if err := g.library.Save(); err != nil {
+		log.Printf("Error saving the ROM library: %s\n", err)
+	}
+}
+
+// Starts the ROM picked in the list.
+func (g *Game) romSelected(args *widget.ListEntrySelectedEventArgs) {
+	// Reselecting the playing ROM after refreshing the list.
+	if g.refreshing {
+		return
+	}
+
+	var li *listItem
+	switch e := args.Entry.(type) {
+	case *listItem:
+		li = e
+	case recentItem:
+		li = e.listItem
+	default:
+		return
+	}
+
+	rom, err := li.read()
+	if err == nil {
+		err = g.loadRom(li.name, rom)
+	}
+	if err != nil {
+		g.notify(err.Error())
+		return
+	}
+
+	g.playing = li
+	g.library.Played(li.meta.Hash)
+	g.saveLibrary()
+	g.refreshRomList()
+}
+
+// Rebuilds the list from the search, the sort order, the
+// favourites and the recently played ROMs.
+func (g *Game) refreshRomList() {
+	query := strings.ToLower(strings.TrimSpace(g.search.GetText()))
+
+	var (
+		matches []*listItem
+		recent  []*listItem
+	)
+	for _, li := range g.roms {
+		if query != "" &&
+			!strings.Contains(strings.ToLower(li.label()), query) &&
+			!strings.Contains(strings.ToLower(li.name), query) {
+			continue
+		}
+
+		matches = append(matches, li)
+		if g.library.RecentIndex(li.meta.Hash) >= 0 {
+			recent = append(recent, li)
+		}
+	}
+
+	sort.SliceStable(recent, func(i, j int) bool {
+		return g.library.RecentIndex(recent[i].meta.Hash) < g.library.RecentIndex(recent[j].meta.Hash)
+	})
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		if fa, fb := g.library.IsFavourite(a.meta.Hash), g.library.IsFavourite(b.meta.Hash); fa != fb {
+			return fa
+		}
+
+		switch g.sortBy {
+		case sortByPlatform:
+			if a.meta.Platform != b.meta.Platform {
+				return a.meta.Platform < b.meta.Platform
+			}
+		case sortBySize:
+			if a.meta.Size != b.meta.Size {
+				return a.meta.Size < b.meta.Size
+			}
+		}
+
+		return strings.ToLower(a.label()) < strings.ToLower(b.label())
+	})
+
+	var entries []any
+	selected := any(nil)
+
+	// The recent ROMs are only a shortcut, so they make way for
+	// the results while searching.
+	if query == "" && len(recent) > 0 {
+		entries = append(entries, sectionHeader("Recent"))
+		for _, li := range recent {
+			entries = append(entries, recentItem{li})
+		}
+		entries = append(entries, sectionHeader("All"))
+	}
+
+	for _, li := range matches {
+		entries = append(entries, li)
+		if li == g.playing {
+			selected = li
+		}
+	}
+
+	g.romList.SetEntries(entries)
+
+	if selected != nil {
+		g.refreshing = true
+		g.romList.SetSelectedEntry(selected)
+		g.refreshing = false
+	}
+}
+
+// Makes the playing ROM a favourite, or not.
+func (g *Game) toggleFavourite() {
+	if g.playing == nil || g.playing.meta.Hash == "" {
+		g.notify("No ROM loaded.")
+		return
+	}
+
+	hash := g.playing.meta.Hash
+	g.library.SetFavourite(hash, !g.library.IsFavourite(hash))
+	g.saveLibrary()
+	g.refreshRomList()
+}
+
+// Moves on to the next sort order.
+func (g *Game) cycleSort() {
+	g.sortBy = (g.sortBy + 1) % romSort(len(romSortLabels))
+	g.sortButton.Text().Label = romSortLabels[g.sortBy]
+	g.refreshRomList()
+}
+
+// Reports whether the player is typing in the search box or
+// rebinding keys, in which case the keys are not meant for the
+// game.
+func (g *Game) capturingKeys() bool {
+	return (g.search != nil && g.search.IsFocused()) || g.rebinding()
+}
+
+// Returns the search box and the buttons shown above the list.
+func (g *Game) newLibraryControls(w int) *widget.Container {
+	face, _ := loadFont(8, font)
+
+	controls := widget.NewContainer(
+		widget.ContainerOpts.BackgroundImage(image.NewNineSliceColor(color.NRGBA{0, 0, 0, 255})),
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+			widget.RowLayoutOpts.Padding(widget.NewInsetsSimple(3)),
+			widget.RowLayoutOpts.Spacing(3),
+		)),
+		widget.ContainerOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(w, libraryControlsHeight),
+		),
+	)
+
+	g.search = widget.NewTextInput(
+		widget.TextInputOpts.WidgetOpts(widget.WidgetOpts.MinSize(w-6, 16)),
+		widget.TextInputOpts.Image(&widget.TextInputImage{
+			Idle:     image.NewNineSliceColor(color.NRGBA{60, 60, 60, 255}),
+			Disabled: image.NewNineSliceColor(color.NRGBA{60, 60, 60, 255}),
+		}),
+		widget.TextInputOpts.Face(face),
+		widget.TextInputOpts.Color(&widget.TextInputColor{
+			Idle:          color.NRGBA{254, 255, 255, 255},
+			Disabled:      color.NRGBA{100, 100, 100, 255},
+			Caret:         color.NRGBA{254, 255, 255, 255},
+			DisabledCaret: color.NRGBA{100, 100, 100, 255},
+		}),
+		widget.TextInputOpts.Padding(widget.NewInsetsSimple(4)),
+		widget.TextInputOpts.CaretOpts(widget.CaretOpts.Size(face, 2)),
+		widget.TextInputOpts.Placeholder("Search"),
+		widget.TextInputOpts.ChangedHandler(func(args *widget.TextInputChangedEventArgs) {
+			g.refreshRomList()
+		}),
+	)
+	controls.AddChild(g.search)
+
+	buttons := widget.NewContainer(
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionHorizontal),
+			widget.RowLayoutOpts.Spacing(3),
+		)),
+	)
+	g.sortButton = newDebugButton(romSortLabels[g.sortBy], face, g.cycleSort)
+	buttons.AddChild(g.sortButton)
+	buttons.AddChild(newDebugButton("Fav", face, g.toggleFavourite))
+	controls.AddChild(buttons)
+
+	return controls
+}
@@ -0,0 +1,104 @@
+// Save state slots. F1-F4 save the running game and Shift+F1-F4
+// load it back. States live under the user's config dir, in a
+// directory named after the ROM's SHA-1 so ROMs sharing a file
+// name keep their own.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+var slotKeys = [...]ebiten.Key{ebiten.KeyF1, ebiten.KeyF2, ebiten.KeyF3, ebiten.KeyF4}
+
+// Saves or loads a slot if one of the slot keys was just pressed.
+func (g *Game) handleSlotKeys() {
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+
+	for i, k := range slotKeys {
+		if !inpututil.IsKeyJustPressed(k) {
+			continue
+		}
+
+		slot := i + 1
+		if shift {
+			if err := g.loadSlot(slot); err != nil {
+				g.notify(fmt.Sprintf("Load slot %d failed: %s", slot, err))
+			} else {
+				g.notify(fmt.Sprintf("Loaded slot %d", slot))
+			}
+		} else {
+			if err := g.saveSlot(slot); err != nil {
+				g.notify(fmt.Sprintf("Save slot %d failed: %s", slot, err))
+			} else {
+				g.notify(fmt.Sprintf("Saved slot %d", slot))
+			}
+		}
+	}
+}
+
+func (g *Game) saveSlot(slot int) error {
+	p, err := slotPath(g.romHash, slot)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return g.c8.SaveState(f)
+}
+
+func (g *Game) loadSlot(slot int) error {
+	p, err := slotPath(g.romHash, slot)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := g.c8.LoadState(f); err != nil {
+		return err
+	}
+
+	// The loaded state replaces whatever faulted, and the history
+	// leads up to another state.
+	g.fault = nil
+	if g.history != nil {
+		g.history.Clear()
+	}
+
+	return nil
+}
+
+// Returns where the state for the ROM with the given hash and slot
+// is kept.
+func slotPath(hash string, slot int) (string, error) {
+	if hash == "" {
+		return "", errors.New("No ROM loaded.")
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "gochip", "states", hash, fmt.Sprintf("slot%d.state", slot)), nil
+}
@@ -9,33 +9,40 @@ import (
 	_ "embed"
 	"fmt"
 	"image/color"
+	"io/fs"
 	"log"
 
 	"github.com/ebitenui/ebitenui/image"
 	"github.com/ebitenui/ebitenui/widget"
-	ebiten "github.com/hajimehoshi/ebiten/v2"
 	text "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/oliveira-a/gochip/library"
 )
 
 type listItem struct {
 	// used for the display name
 	name string
 
-	// holds the path to the rom in the our embedded
-	// directory. Later used in the callback function
-	// defined in the client code.
+	// the hash, size, title and platform of the rom. The title
+	// is shown instead of the name if known.
+	meta library.Meta
+
+	// holds the path to the rom in fsys, which is either our
+	// embedded directory or one on disk. Later used in the
+	// callback function defined in the client code.
 	path string
+	fsys fs.FS
 }
 
 //go:embed static/press-start-2p.ttf
 var font []byte
 
-// The side list that allows the user to select a game
+// The side list that allows the user to select a game. The
+// entries are the ones romLabel knows.
 func newRomList(
 	items []any,
 	entrySelectedEventHandler func(args *widget.ListEntrySelectedEventArgs),
 	w, h int,
-) *widget.Container {
+) (*widget.Container, *widget.List) {
 	root := widget.NewContainer(
 		widget.ContainerOpts.Layout(widget.NewGridLayout(
 			widget.GridLayoutOpts.Columns(2),
@@ -110,9 +117,7 @@ func newRomList(
 
 		// Select the property from the list item struct (if
 		// any) with this callback function.
-		widget.ListOpts.EntryLabelFunc(func(e interface{}) string {
-			return e.(listItem).name
-		}),
+		widget.ListOpts.EntryLabelFunc(romLabel),
 
 		// Provide the function to run when a list item is
 		// selected.
@@ -121,7 +126,7 @@ func newRomList(
 
 	root.AddChild(lw)
 
-	return root
+	return root, lw
 }
 
 func loadListItemButtonImage() (*widget.ButtonImage, error) {
@@ -136,19 +141,39 @@ func loadListItemButtonImage() (*widget.ButtonImage, error) {
 	}, nil
 }
 
-func newTickRateContextMenu() *widget.Container {
+func newContextMenu() *widget.Container {
 	contextMenu := widget.NewContainer(
 		widget.ContainerOpts.Layout(widget.NewRowLayout(widget.RowLayoutOpts.Direction(widget.DirectionVertical))),
 	)
 
-	contextMenu.AddChild(newTickRateContextMenuButton(60))
-	contextMenu.AddChild(newTickRateContextMenuButton(120))
-	contextMenu.AddChild(newTickRateContextMenuButton(240))
+	contextMenu.AddChild(newContextMenuButton("Open ROM", func() {
+		game.browser.show(game.ui)
+	}))
+	contextMenu.AddChild(newContextMenuButton("Rebind keys", func() {
+		game.startRebind(false)
+	}))
+	contextMenu.AddChild(newContextMenuButton("Rebind for ROM", func() {
+		game.startRebind(true)
+	}))
+
+	contextMenu.AddChild(newContextMenuButton("Next palette", func() {
+		game.cyclePalette()
+	}))
+	contextMenu.AddChild(newContextMenuButton("Pixel fade", func() {
+		game.toggleFade()
+	}))
+
+	for _, ipf := range []int{7, 11, 15, 30, 100, 1000} {
+		ipf := ipf
+		contextMenu.AddChild(newContextMenuButton(fmt.Sprintf("%-5d IPF", ipf), func() {
+			game.ipf = ipf
+		}))
+	}
 
 	return contextMenu
 }
 
-func newTickRateContextMenuButton(tickRate int) *widget.Button {
+func newContextMenuButton(label string, clicked func()) *widget.Button {
 	btnImg, _ := loadContextMenuButtonImage()
 	face, _ := loadFont(10, font)
 	btn := widget.NewButton(
@@ -156,7 +181,7 @@ func newTickRateContextMenuButton(tickRate int) *widget.Button {
 		widget.ButtonOpts.Image(btnImg),
 
 		// specify the button's text, the font face, and the color
-		widget.ButtonOpts.Text(fmt.Sprintf("%-5d TPS", tickRate), face, &widget.ButtonTextColor{
+		widget.ButtonOpts.Text(label, face, &widget.ButtonTextColor{
 			Idle:  color.NRGBA{0, 0, 0, 255},
 			Hover: color.NRGBA{255, 255, 255, 255},
 		}),
@@ -164,7 +189,7 @@ func newTickRateContextMenuButton(tickRate int) *widget.Button {
 		widget.ButtonOpts.TextPadding(widget.NewInsetsSimple(5)),
 
 		widget.ButtonOpts.ClickedHandler(func(args *widget.ButtonClickedEventArgs) {
-			ebiten.SetTPS(tickRate)
+			clicked()
 		}),
 	)
 